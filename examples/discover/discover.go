@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/ernestrc/gortc/stun"
+)
+
+var server = flag.String("server", "localhost:8012", "address of a NAT behavior discovery server")
+var lifetime = flag.Duration("lifetime", 0, "longest binding lifetime to probe, zero to skip")
+var timeout = flag.Duration("timeout", 10*time.Minute, "discovery timeout")
+
+func main() {
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	log.Printf("discovering NAT behavior with %s\n", *server)
+
+	d := &stun.NATDiscovery{Server: *server, MaxLifetime: *lifetime}
+	result, err := d.Discover(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("mapped address: %s\n", result.MappedAddress)
+	log.Printf("behind NAT: %t\n", result.NAT)
+	log.Printf("mapping: %s\n", result.Mapping)
+	log.Printf("filtering: %s\n", result.Filtering)
+	log.Printf("hairpinning: %t\n", result.Hairpinning)
+	if *lifetime > 0 {
+		log.Printf("binding lifetime: at least %s\n", result.BindingLifetime)
+	}
+	log.Printf("recommended keepalive interval: %s\n", result.KeepAliveInterval())
+}
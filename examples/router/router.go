@@ -1,69 +1,39 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
-)
 
-const (
-	maxipdatalen = 65535
-	ipheaderlen  = 20
-	maxpacket    = maxipdatalen - ipheaderlen
+	"github.com/ernestrc/gortc/stun"
 )
 
-var handlers map[net.Addr]*handler
-var sockserv net.PacketConn
+var (
+	addr      = flag.String("addr", ":8012", "address to listen on")
+	alternate = flag.String("alternate", "", "alternate address for NAT behavior discovery")
+)
 
-func init() {
-	handlers = make(map[net.Addr]*handler)
-}
+func main() {
+	flag.Parse()
 
-func (h *handler) handle(data []byte) {
-	log.Printf("received %d bytes (%s) from %v\n", len(data), data, h.addr)
+	srv := &stun.Server{Software: "gortc router"}
 
-	switch string(data) {
-	case "ping":
-		n, err := sockserv.WriteTo([]byte("pong"), h.addr)
-		if err != nil {
-			log.Printf("error when writing to addr %v: %+v", h.addr, err)
-			return
+	if *alternate != "" {
+		// the wildcard address would take the port on the alternate IP address too
+		if host, _, err := net.SplitHostPort(*addr); err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+			log.Fatalf("-addr must have a specific IP address when -alternate is set, %q found", *addr)
 		}
 
-		log.Printf("sent %d bytes (pong) to %v", n, h.addr)
-
-		// cleanup handler
-		handlers[h.addr] = nil
-	default:
-		// ignore
+		log.Printf("router listening on %v and %v\n", *addr, *alternate)
+		log.Fatal(srv.ListenAndServeAlternate("udp", *addr, *alternate))
 	}
-}
-
-type handler struct {
-	addr net.Addr
-}
 
-func main() {
-	var err error
-	sockserv, err = net.ListenPacket("udp", ":8012")
+	pc, err := net.ListenPacket("udp", *addr)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("router listening on %v\n", sockserv.LocalAddr())
-
-	packet := make([]byte, maxpacket)
-
-	for {
-		n, addr, err := sockserv.ReadFrom(packet)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+	log.Printf("router listening on %v\n", pc.LocalAddr())
 
-		if handlers[addr] == nil {
-			handlers[addr] = &handler{addr}
-		}
-
-		handlers[addr].handle(packet[:n])
-	}
+	log.Fatal(srv.Serve(pc))
 }
@@ -1,48 +1,51 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
-	"fmt"
 	"log"
 	"net"
+	"strconv"
+	"time"
+
+	"github.com/ernestrc/gortc/stun"
 )
 
+var network = flag.String("network", "udp", "network to dial to: udp, tcp or tls")
 var iface = flag.String("iface", "localhost", "interface to dial to")
 var port = flag.Int("port", 8012, "port to dial to")
+var timeout = flag.Duration("timeout", 40*time.Second, "transaction timeout")
 
 func main() {
 	flag.Parse()
 
-	addr := fmt.Sprintf("%s:%d", *iface, *port)
+	addr := net.JoinHostPort(*iface, strconv.Itoa(*port))
 
 	log.Printf("connecting to addr %s\n", addr)
 
-	conn, err := net.Dial("udp", addr)
+	conn, err := stun.Dial(*network, addr)
 	if err != nil {
 		log.Fatal(err)
 	}
-	reader := bufio.NewReader(conn)
-	_, err = fmt.Fprintf(conn, "ping")
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	log.Printf("waiting for response.. \n")
+
+	resp, err := stun.NewClient(conn).Do(ctx, stun.Message{
+		Class:  stun.Request,
+		Method: stun.Binding,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("waiting for response.. \n")
-
-	response := make([]byte, 4)
-
-	for {
-		status, err := reader.Read(response)
-		if err != nil {
-			log.Fatal(err)
-		}
-		switch string(response) {
-		case "pong":
-			log.Printf("got it\n")
-			return
-		default:
-			log.Fatal("unknown message", status)
-		}
+	mapped, err := resp.XORMappedAddress()
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	log.Printf("got it: mapped address is %s\n", mapped)
 }
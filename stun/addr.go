@@ -0,0 +1,205 @@
+package stun
+
+import (
+	"fmt"
+	"net"
+)
+
+// address families as described in RFC-5389 section-15.1
+const (
+	familyIPv4 byte = 0x01
+	familyIPv6 byte = 0x02
+)
+
+var (
+	// ErrAttrNotFound is returned when the requested attribute
+	// is not present in the message
+	ErrAttrNotFound = fmt.Errorf("attribute not found")
+	// ErrBadAddress is returned when an address attribute
+	// has an unknown family or an invalid length
+	ErrBadAddress = fmt.Errorf("bad address attribute")
+)
+
+// Get returns the value of the first attribute of type t in the message
+func (msg *Message) Get(t AttrType) (value []byte, err error) {
+	for _, a := range msg.Attr {
+		if a.Type == t {
+			return a.Value, nil
+		}
+	}
+
+	err = ErrAttrNotFound
+	return
+}
+
+// Set replaces the value of the first attribute of type t in the message
+// or appends a new attribute if there is none
+func (msg *Message) Set(t AttrType, value []byte) {
+	for i, a := range msg.Attr {
+		if a.Type == t {
+			msg.Attr[i].Value = value
+			return
+		}
+	}
+
+	msg.Attr = append(msg.Attr, Attribute{Type: t, Value: value})
+}
+
+// transportAddr returns the IP address and port of a UDP or TCP address
+func transportAddr(addr net.Addr) (*net.UDPAddr, bool) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a, true
+	case *net.TCPAddr:
+		return &net.UDPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}, true
+	default:
+		return nil, false
+	}
+}
+
+// decodeAddr decodes a MAPPED-ADDRESS like attribute value. If key is not nil,
+// port is XOR'd with its first 2 bytes and the address with its first 4 or 16 bytes
+// as described in RFC-5389 section-15.2
+func decodeAddr(value []byte, key []byte) (addr *net.UDPAddr, err error) {
+	if len(value) < 4 {
+		err = ErrBadAddress
+		return
+	}
+
+	var ip net.IP
+	switch value[1] {
+	case familyIPv4:
+		ip = make(net.IP, net.IPv4len)
+	case familyIPv6:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		err = ErrBadAddress
+		return
+	}
+
+	if len(value[4:]) != len(ip) || (key != nil && len(key) < len(ip)) {
+		err = ErrBadAddress
+		return
+	}
+
+	copy(ip, value[4:])
+	port := int(uint16(value[2])<<8 | uint16(value[3]))
+
+	if key != nil {
+		port ^= int(uint16(key[0])<<8 | uint16(key[1]))
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	addr = &net.UDPAddr{IP: ip, Port: port}
+	return
+}
+
+// encodeAddr is the inverse of decodeAddr
+func encodeAddr(addr *net.UDPAddr, key []byte) (value []byte, err error) {
+	family := familyIPv6
+	ip := addr.IP.To16()
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		family = familyIPv4
+		ip = ip4
+	}
+
+	if ip == nil || (key != nil && len(key) < len(ip)) {
+		err = ErrBadAddress
+		return
+	}
+
+	value = make([]byte, 4+len(ip))
+	value[1] = family
+	value[2] = byte(addr.Port >> 8)
+	value[3] = byte(addr.Port)
+	copy(value[4:], ip)
+
+	if key != nil {
+		value[2] ^= key[0]
+		value[3] ^= key[1]
+		for i := range ip {
+			value[4+i] ^= key[i]
+		}
+	}
+
+	return
+}
+
+// getAddr decodes the MAPPED-ADDRESS like attribute of type t of the message
+func (msg *Message) getAddr(t AttrType) (addr *net.UDPAddr, err error) {
+	var value []byte
+	if value, err = msg.Get(t); err != nil {
+		return
+	}
+
+	return decodeAddr(value, nil)
+}
+
+// setAddr encodes addr into the MAPPED-ADDRESS like attribute of type t of the message
+func (msg *Message) setAddr(t AttrType, addr *net.UDPAddr) (err error) {
+	var value []byte
+	if value, err = encodeAddr(addr, nil); err != nil {
+		return
+	}
+
+	msg.Set(t, value)
+	return
+}
+
+// XORMappedAddress decodes the XOR-MAPPED-ADDRESS attribute of the message
+// as described in RFC-5389 section-15.2. The message must have a 16 bytes transaction ID.
+func (msg *Message) XORMappedAddress() (addr *net.UDPAddr, err error) {
+	var value []byte
+	if value, err = msg.Get(XORMappedAddress); err != nil {
+		return
+	}
+
+	if len(msg.ID) != 16 {
+		err = ErrBadTransactionID
+		return
+	}
+
+	// magic cookie + transaction ID
+	return decodeAddr(value, msg.ID)
+}
+
+// SetXORMappedAddress encodes addr into the XOR-MAPPED-ADDRESS attribute of the message,
+// which must have a 16 bytes transaction ID
+func (msg *Message) SetXORMappedAddress(addr *net.UDPAddr) (err error) {
+	if len(msg.ID) != 16 {
+		err = ErrBadTransactionID
+		return
+	}
+
+	var value []byte
+	if value, err = encodeAddr(addr, msg.ID); err != nil {
+		return
+	}
+
+	msg.Set(XORMappedAddress, value)
+	return
+}
+
+// MappedAddress decodes the MAPPED-ADDRESS attribute of the message
+// as described in RFC-5389 section-15.1
+func (msg *Message) MappedAddress() (*net.UDPAddr, error) {
+	return msg.getAddr(MappedAddress)
+}
+
+// SetMappedAddress encodes addr into the MAPPED-ADDRESS attribute of the message
+func (msg *Message) SetMappedAddress(addr *net.UDPAddr) error {
+	return msg.setAddr(MappedAddress, addr)
+}
+
+// AlternateServer decodes the ALTERNATE-SERVER attribute of the message
+// as described in RFC-5389 section-15.11
+func (msg *Message) AlternateServer() (*net.UDPAddr, error) {
+	return msg.getAddr(AlternateServer)
+}
+
+// SetAlternateServer encodes addr into the ALTERNATE-SERVER attribute of the message
+func (msg *Message) SetAlternateServer(addr *net.UDPAddr) error {
+	return msg.setAddr(AlternateServer, addr)
+}
@@ -0,0 +1,61 @@
+package stun
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+// RFC 5769 section 2.2 and 2.3 mapped address
+var rfc5769MappedAddr = &net.UDPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 32853}
+var rfc5769MappedAddrIPv6 = &net.UDPAddr{IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853}
+
+func TestXORMappedAddress(t *testing.T) {
+	for _, tcase := range []struct {
+		msg  Message
+		addr *net.UDPAddr
+	}{
+		{rfc5769SampleResponse, rfc5769MappedAddr},
+		{rfc5769SampleResponseIPv6, rfc5769MappedAddrIPv6},
+	} {
+		addr, err := tcase.msg.XORMappedAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !addr.IP.Equal(tcase.addr.IP) || addr.Port != tcase.addr.Port {
+			t.Errorf("expected %s found %s", tcase.addr, addr)
+		}
+
+		expected, _ := tcase.msg.Get(XORMappedAddress)
+		msg := Message{ID: tcase.msg.ID}
+		if err := msg.SetXORMappedAddress(tcase.addr); err != nil {
+			t.Fatal(err)
+		}
+		found, _ := msg.Get(XORMappedAddress)
+		if !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %#v found %#v", expected, found)
+		}
+	}
+}
+
+func TestXORMappedAddressErrors(t *testing.T) {
+	if _, err := rfc5769SampleRequest.XORMappedAddress(); err != ErrAttrNotFound {
+		t.Errorf("expected ErrAttrNotFound but %v found", err)
+	}
+
+	msg := Message{
+		ID:   rfc5769SampleResponse.ID,
+		Attr: []Attribute{{Type: XORMappedAddress, Value: []byte{0x00, 0x03, 0xa1, 0x47}}},
+	}
+	if _, err := msg.XORMappedAddress(); err != ErrBadAddress {
+		t.Errorf("expected ErrBadAddress but %v found", err)
+	}
+
+	msg = Message{Attr: rfc5769SampleResponse.Attr}
+	if _, err := msg.XORMappedAddress(); err != ErrBadTransactionID {
+		t.Errorf("expected ErrBadTransactionID but %v found", err)
+	}
+	if err := msg.SetXORMappedAddress(rfc5769MappedAddr); err != ErrBadTransactionID {
+		t.Errorf("expected ErrBadTransactionID but %v found", err)
+	}
+}
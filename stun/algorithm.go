@@ -0,0 +1,163 @@
+package stun
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// Algorithm is a password algorithm as described in RFC-8489 section-18.5
+type Algorithm uint16
+
+const (
+	AlgorithmMD5    Algorithm = 0x0001
+	AlgorithmSHA256 Algorithm = 0x0002
+)
+
+// ErrBadPasswordAlgorithm is returned when a PASSWORD-ALGORITHM or
+// PASSWORD-ALGORITHMS attribute has an invalid length
+var ErrBadPasswordAlgorithm = fmt.Errorf("bad password algorithm attribute")
+
+// Supported returns whether the algorithm is implemented by this package
+func (alg Algorithm) Supported() bool {
+	return alg == AlgorithmMD5 || alg == AlgorithmSHA256
+}
+
+// Key returns the long-term key for the given credentials as described in
+// RFC-8489 section-9.2.2. The password is expected to be already processed
+// with OpaqueString. Unsupported algorithms return nil.
+func (alg Algorithm) Key(username, realm, password string) []byte {
+	switch alg {
+	case AlgorithmMD5:
+		return LongTermKey(username, realm, password)
+	case AlgorithmSHA256:
+		h := sha256.Sum256([]byte(username + ":" + realm + ":" + password))
+		return h[:]
+	default:
+		return nil
+	}
+}
+
+// NewUserHash returns the value of the USERHASH attribute for the given
+// credentials as described in RFC-8489 section-14.5
+func NewUserHash(username, realm string) []byte {
+	h := sha256.Sum256([]byte(username + ":" + realm))
+	return h[:]
+}
+
+// encodeAlgorithms encodes algorithms without parameters into a
+// PASSWORD-ALGORITHMS like attribute value
+func encodeAlgorithms(algs []Algorithm) []byte {
+	value := make([]byte, 4*len(algs))
+	for i, alg := range algs {
+		value[4*i] = byte(alg >> 8)
+		value[4*i+1] = byte(alg)
+	}
+
+	return value
+}
+
+// decodeAlgorithms is the inverse of encodeAlgorithms skipping any parameters
+func decodeAlgorithms(value []byte) (algs []Algorithm, err error) {
+	for len(value) > 0 {
+		if len(value) < 4 {
+			err = ErrBadPasswordAlgorithm
+			return
+		}
+
+		alg := Algorithm(uint16(value[0])<<8 | uint16(value[1]))
+		// parameters are aligned at 32-bit boundary
+		length := 4 + (int(uint16(value[2])<<8|uint16(value[3]))+3)&^3
+		if length > len(value) {
+			err = ErrBadPasswordAlgorithm
+			return
+		}
+
+		algs = append(algs, alg)
+		value = value[length:]
+	}
+
+	return
+}
+
+// PasswordAlgorithms decodes the PASSWORD-ALGORITHMS attribute of the message
+// as described in RFC-8489 section-14.11
+func (msg *Message) PasswordAlgorithms() (algs []Algorithm, err error) {
+	var value []byte
+	if value, err = msg.Get(PasswordAlgorithms); err != nil {
+		return
+	}
+
+	return decodeAlgorithms(value)
+}
+
+// SetPasswordAlgorithms encodes algs into the PASSWORD-ALGORITHMS attribute of the message
+func (msg *Message) SetPasswordAlgorithms(algs []Algorithm) {
+	msg.Set(PasswordAlgorithms, encodeAlgorithms(algs))
+}
+
+// PasswordAlgorithm decodes the PASSWORD-ALGORITHM attribute of the message
+// as described in RFC-8489 section-14.12
+func (msg *Message) PasswordAlgorithm() (alg Algorithm, err error) {
+	var value []byte
+	if value, err = msg.Get(PasswordAlgorithm); err != nil {
+		return
+	}
+
+	var algs []Algorithm
+	if algs, err = decodeAlgorithms(value); err != nil {
+		return
+	}
+
+	if len(algs) != 1 {
+		err = ErrBadPasswordAlgorithm
+		return
+	}
+
+	return algs[0], nil
+}
+
+// SetPasswordAlgorithm encodes alg into the PASSWORD-ALGORITHM attribute of the message
+func (msg *Message) SetPasswordAlgorithm(alg Algorithm) {
+	msg.Set(PasswordAlgorithm, encodeAlgorithms([]Algorithm{alg}))
+}
+
+// nonceCookie is the prefix of nonces issued by RFC-8489 servers
+// followed by the base64 encoded security feature set
+const nonceCookie = "obMatJos2"
+
+// length of the nonce cookie including the encoded security feature set
+const nonceCookieLen = len(nonceCookie) + 4
+
+// security feature set bits as described in RFC-8489 section-18.1
+const (
+	featurePasswordAlgorithms uint32 = 1 << 23
+	featureUsernameAnonymity  uint32 = 1 << 22
+)
+
+// encodeNonceCookie returns the nonce cookie advertising the given security features
+func encodeNonceCookie(features uint32) []byte {
+	set := []byte{byte(features >> 16), byte(features >> 8), byte(features)}
+
+	cookie := make([]byte, nonceCookieLen)
+	copy(cookie, nonceCookie)
+	base64.StdEncoding.Encode(cookie[len(nonceCookie):], set)
+
+	return cookie
+}
+
+// decodeNonceCookie returns the security features advertised in the nonce
+// or false if the nonce does not start with a nonce cookie
+func decodeNonceCookie(nonce []byte) (features uint32, ok bool) {
+	if len(nonce) < nonceCookieLen || !bytes.HasPrefix(nonce, []byte(nonceCookie)) {
+		return
+	}
+
+	var set [3]byte
+	if _, err := base64.StdEncoding.Decode(set[:], nonce[len(nonceCookie):nonceCookieLen]); err != nil {
+		return
+	}
+
+	return uint32(set[0])<<16 | uint32(set[1])<<8 | uint32(set[2]), true
+}
@@ -0,0 +1,238 @@
+package stun
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testUserHashStore looks up the RFC 5769 long-term credentials by USERHASH
+type testUserHashStore struct {
+	CredentialStoreFunc
+}
+
+func (s testUserHashStore) User(userhash []byte, realm string) (string, bool) {
+	if bytes.Equal(userhash, NewUserHash(rfc5769LongTermUsername, realm)) {
+		return rfc5769LongTermUsername, true
+	}
+	return "", false
+}
+
+func TestNonceCookie(t *testing.T) {
+	for _, features := range []uint32{
+		0,
+		featurePasswordAlgorithms,
+		featureUsernameAnonymity,
+		featurePasswordAlgorithms | featureUsernameAnonymity,
+	} {
+		nonce := append(encodeNonceCookie(features), "rest of the nonce"...)
+		if !bytes.HasPrefix(nonce, []byte(nonceCookie)) {
+			t.Errorf("expected nonce to start with %q but %q found", nonceCookie, nonce)
+		}
+
+		found, ok := decodeNonceCookie(nonce)
+		if !ok || found != features {
+			t.Errorf("expected features %#06x found %#06x", features, found)
+		}
+	}
+
+	// RFC 8489 section 9.2 example for password algorithms
+	if features, ok := decodeNonceCookie([]byte("obMatJos2gAAAadl7W7PeDU4hKE72jda")); !ok || features != featurePasswordAlgorithms {
+		t.Errorf("expected password algorithms feature but %#06x found", features)
+	}
+
+	if _, ok := decodeNonceCookie([]byte("f//499k954d6OL34oL9FSTvy64sA")); ok {
+		t.Errorf("expected nonce without cookie")
+	}
+}
+
+func TestPasswordAlgorithms(t *testing.T) {
+	var msg Message
+	algs := []Algorithm{AlgorithmSHA256, AlgorithmMD5}
+
+	msg.SetPasswordAlgorithms(algs)
+	msg.SetPasswordAlgorithm(AlgorithmSHA256)
+
+	if found, err := msg.PasswordAlgorithms(); err != nil || !reflect.DeepEqual(algs, found) {
+		t.Errorf("expected %v found %v (%v)", algs, found, err)
+	}
+	if found, err := msg.PasswordAlgorithm(); err != nil || found != AlgorithmSHA256 {
+		t.Errorf("expected %v found %v (%v)", AlgorithmSHA256, found, err)
+	}
+
+	// algorithm parameters are skipped
+	msg.Set(PasswordAlgorithms, []byte{0x00, 0x03, 0x00, 0x01, 0xff, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00})
+	if found, err := msg.PasswordAlgorithms(); err != nil || !reflect.DeepEqual([]Algorithm{3, AlgorithmMD5}, found) {
+		t.Errorf("expected [3 1] found %v (%v)", found, err)
+	}
+
+	msg.Set(PasswordAlgorithms, []byte{0x00, 0x01, 0x00, 0x04})
+	if _, err := msg.PasswordAlgorithms(); err != ErrBadPasswordAlgorithm {
+		t.Errorf("expected ErrBadPasswordAlgorithm but %v found", err)
+	}
+}
+
+func TestIntegritySHA256(t *testing.T) {
+	key := AlgorithmSHA256.Key(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+
+	for _, length := range []int{0, 16, 20, 24, 28, 32} {
+		data, err := Marshal(rfc5769SampleRequestLongTermAuth)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, err = AddIntegritySHA256(data, key, length); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckIntegritySHA256(data, key); err != nil {
+			t.Errorf("expected integrity truncated to %d bytes to be valid: %v", length, err)
+		}
+		if err := CheckIntegritySHA256(data, []byte("bad key")); err != ErrIntegrity {
+			t.Errorf("expected ErrIntegrity but %v found", err)
+		}
+
+		// MESSAGE-INTEGRITY is still valid
+		longTerm := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+		if err := CheckIntegrity(data, longTerm); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, length := range []int{12, 18, 36} {
+		if _, err := AddIntegritySHA256(make([]byte, 20), key, length); err != ErrMalformed {
+			t.Errorf("expected ErrMalformed for length %d but %v found", length, err)
+		}
+	}
+}
+
+func TestClientPasswordAlgorithms(t *testing.T) {
+	for _, auth := range []*LongTermAuth{
+		{PasswordAlgorithms: []Algorithm{AlgorithmSHA256, AlgorithmMD5}},
+		{PasswordAlgorithms: []Algorithm{AlgorithmMD5}},
+		{UserHash: true},
+		{PasswordAlgorithms: []Algorithm{AlgorithmSHA256}, UserHash: true},
+	} {
+		auth.Realm = rfc5769LongTermRealm
+		auth.Credentials = testUserHashStore{testCredentials}
+
+		conn, pc := serveTestServer(t, &Server{Handler: auth})
+
+		client := &Client{
+			Conn:     conn,
+			Username: rfc5769LongTermUsername,
+			Password: rfc5769LongTermPassword,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+		cancel()
+
+		conn.Close()
+		pc.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkType(t, &resp, Binding, SuccessResponse)
+
+		if _, err := resp.Get(MessageIntegritySHA256); err != nil {
+			t.Errorf("expected response to be protected with MESSAGE-INTEGRITY-SHA256")
+		}
+	}
+}
+
+func TestPasswordAlgorithmsBidDown(t *testing.T) {
+	auth := &LongTermAuth{
+		Realm:              rfc5769LongTermRealm,
+		Credentials:        testCredentials,
+		PasswordAlgorithms: []Algorithm{AlgorithmSHA256, AlgorithmMD5},
+	}
+	conn, pc := serveTestServer(t, &Server{Handler: auth})
+	defer pc.Close()
+	defer conn.Close()
+
+	auth.init()
+	nonce := auth.nonce("127.0.0.1")
+	if features, _ := decodeNonceCookie(nonce); features != featurePasswordAlgorithms {
+		t.Fatalf("expected nonce cookie with password algorithms but %q found", nonce)
+	}
+
+	for _, tcase := range []struct {
+		algs []Algorithm
+		alg  Algorithm
+		code Error
+	}{
+		// PASSWORD-ALGORITHMS modified by an attacker
+		{[]Algorithm{AlgorithmMD5}, AlgorithmMD5, ErrBadRequest},
+		// PASSWORD-ALGORITHM not offered by the server
+		{[]Algorithm{AlgorithmSHA256, AlgorithmMD5}, Algorithm(3), ErrBadRequest},
+	} {
+		msg := Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID}
+		msg.Set(Username, []byte(rfc5769LongTermUsername))
+		msg.Set(Realm, []byte(rfc5769LongTermRealm))
+		msg.Set(Nonce, nonce)
+		msg.SetPasswordAlgorithms(tcase.algs)
+		msg.SetPasswordAlgorithm(tcase.alg)
+
+		data, err := Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := tcase.alg.Key(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+		if data, err = AddIntegritySHA256(data, key, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, _ := exchange(t, pc, data)
+		checkType(t, &resp, Binding, ErrorResponse)
+		if e, _ := resp.ErrorCode(); e != tcase.code {
+			t.Errorf("expected %v found %v", tcase.code, e)
+		}
+	}
+}
+
+func TestClientPasswordAlgorithmsStripped(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	go func() {
+		buf := make([]byte, maxpacket)
+		for {
+			n, addr, err := peer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, _ := Unmarshal(buf[:n])
+
+			// PASSWORD-ALGORITHMS removed by an attacker
+			resp := req.ErrorResponse(ErrUnauthorized)
+			resp.Set(Realm, []byte(rfc5769LongTermRealm))
+			resp.Set(Nonce, append(encodeNonceCookie(featurePasswordAlgorithms), "nonce"...))
+			data, _ := Marshal(resp)
+			peer.WriteTo(data, addr)
+		}
+	}()
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := resp.ErrorCode(); e != ErrUnauthorized {
+		t.Errorf("expected %v found %v", ErrUnauthorized, e)
+	}
+	if realm, nonce, _ := client.credentials(); realm != nil || nonce != nil {
+		t.Errorf("expected challenge not to be cached but %q and %q found", realm, nonce)
+	}
+}
@@ -0,0 +1,217 @@
+package stun
+
+import (
+	"fmt"
+	"net"
+	"unicode/utf8"
+)
+
+// Setter encodes a typed attribute into a message
+type Setter interface {
+	// AddTo sets the attribute in msg replacing any previous one of the same type
+	AddTo(msg *Message) error
+}
+
+// Getter decodes a typed attribute from a message
+type Getter interface {
+	// GetFrom decodes the first attribute of its type in msg
+	GetFrom(msg *Message) error
+}
+
+// ErrBadText is returned when a text attribute exceeds
+// its length limits or is not valid UTF-8
+var ErrBadText = fmt.Errorf("bad text attribute")
+
+// textLimit is the maximum length of a text attribute value
+// in bytes and in characters, zero meaning no limit
+type textLimit struct {
+	bytes int
+	chars int
+}
+
+// textLimits as described in RFC-5389 section-15.3, 15.7, 15.8 and 15.10
+var textLimits = map[AttrType]textLimit{
+	Username: {bytes: 512},
+	Realm:    {bytes: 763, chars: 127},
+	Nonce:    {bytes: 763, chars: 127},
+	Software: {bytes: 763, chars: 127},
+}
+
+// checkText returns ErrBadText if value is not a valid text attribute of type t
+func checkText(t AttrType, value []byte) error {
+	limit := textLimits[t]
+	if len(value) > limit.bytes || !utf8.Valid(value) {
+		return ErrBadText
+	}
+
+	if limit.chars > 0 && utf8.RuneCount(value) > limit.chars {
+		return ErrBadText
+	}
+
+	return nil
+}
+
+func setText(msg *Message, t AttrType, value []byte) (err error) {
+	if err = checkText(t, value); err != nil {
+		return
+	}
+
+	msg.Set(t, value)
+	return
+}
+
+func getText(msg *Message, t AttrType) (value []byte, err error) {
+	if value, err = msg.Get(t); err != nil {
+		return
+	}
+
+	err = checkText(t, value)
+	return
+}
+
+// SoftwareAttr is the SOFTWARE attribute as described in RFC-5389 section-15.10
+type SoftwareAttr string
+
+func (s SoftwareAttr) AddTo(msg *Message) error {
+	return setText(msg, Software, []byte(s))
+}
+
+func (s *SoftwareAttr) GetFrom(msg *Message) (err error) {
+	var value []byte
+	if value, err = getText(msg, Software); err == nil {
+		*s = SoftwareAttr(value)
+	}
+	return
+}
+
+// UsernameAttr is the USERNAME attribute as described in RFC-5389 section-15.3
+type UsernameAttr string
+
+func (u UsernameAttr) AddTo(msg *Message) error {
+	return setText(msg, Username, []byte(u))
+}
+
+func (u *UsernameAttr) GetFrom(msg *Message) (err error) {
+	var value []byte
+	if value, err = getText(msg, Username); err == nil {
+		*u = UsernameAttr(value)
+	}
+	return
+}
+
+// RealmAttr is the REALM attribute as described in RFC-5389 section-15.7
+type RealmAttr string
+
+func (r RealmAttr) AddTo(msg *Message) error {
+	return setText(msg, Realm, []byte(r))
+}
+
+func (r *RealmAttr) GetFrom(msg *Message) (err error) {
+	var value []byte
+	if value, err = getText(msg, Realm); err == nil {
+		*r = RealmAttr(value)
+	}
+	return
+}
+
+// NonceAttr is the NONCE attribute as described in RFC-5389 section-15.8
+type NonceAttr []byte
+
+func (n NonceAttr) AddTo(msg *Message) error {
+	return setText(msg, Nonce, n)
+}
+
+func (n *NonceAttr) GetFrom(msg *Message) (err error) {
+	var value []byte
+	if value, err = getText(msg, Nonce); err == nil {
+		*n = NonceAttr(value)
+	}
+	return
+}
+
+// AddTo sets e as the ERROR-CODE attribute of the message
+func (e Error) AddTo(msg *Message) error {
+	return msg.SetErrorCode(e)
+}
+
+// GetFrom decodes the ERROR-CODE attribute of the message into e
+func (e *Error) GetFrom(msg *Message) (err error) {
+	var found Error
+	if found, err = msg.ErrorCode(); err == nil {
+		*e = found
+	}
+	return
+}
+
+// MappedAddressAttr is the MAPPED-ADDRESS attribute as described in RFC-5389 section-15.1
+type MappedAddressAttr net.UDPAddr
+
+func (a *MappedAddressAttr) AddTo(msg *Message) error {
+	return msg.SetMappedAddress((*net.UDPAddr)(a))
+}
+
+func (a *MappedAddressAttr) GetFrom(msg *Message) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = msg.MappedAddress(); err == nil {
+		*a = MappedAddressAttr(*addr)
+	}
+	return
+}
+
+func (a *MappedAddressAttr) String() string {
+	return (*net.UDPAddr)(a).String()
+}
+
+// XORMappedAddressAttr is the XOR-MAPPED-ADDRESS attribute as described in RFC-5389 section-15.2
+type XORMappedAddressAttr net.UDPAddr
+
+func (a *XORMappedAddressAttr) AddTo(msg *Message) error {
+	return msg.SetXORMappedAddress((*net.UDPAddr)(a))
+}
+
+func (a *XORMappedAddressAttr) GetFrom(msg *Message) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = msg.XORMappedAddress(); err == nil {
+		*a = XORMappedAddressAttr(*addr)
+	}
+	return
+}
+
+func (a *XORMappedAddressAttr) String() string {
+	return (*net.UDPAddr)(a).String()
+}
+
+// AlternateServerAttr is the ALTERNATE-SERVER attribute as described in RFC-5389 section-15.11
+type AlternateServerAttr net.UDPAddr
+
+func (a *AlternateServerAttr) AddTo(msg *Message) error {
+	return msg.SetAlternateServer((*net.UDPAddr)(a))
+}
+
+func (a *AlternateServerAttr) GetFrom(msg *Message) (err error) {
+	var addr *net.UDPAddr
+	if addr, err = msg.AlternateServer(); err == nil {
+		*a = AlternateServerAttr(*addr)
+	}
+	return
+}
+
+func (a *AlternateServerAttr) String() string {
+	return (*net.UDPAddr)(a).String()
+}
+
+// UnknownAttributesAttr is the UNKNOWN-ATTRIBUTES attribute as described in RFC-5389 section-15.9
+type UnknownAttributesAttr []AttrType
+
+func (u UnknownAttributesAttr) AddTo(msg *Message) error {
+	msg.SetUnknownAttributes(u)
+	return nil
+}
+
+func (u *UnknownAttributesAttr) GetFrom(msg *Message) (err error) {
+	var types []AttrType
+	if types, err = msg.UnknownAttributes(); err == nil {
+		*u = types
+	}
+	return
+}
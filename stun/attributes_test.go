@@ -0,0 +1,155 @@
+package stun
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTextAttributes(t *testing.T) {
+	var software SoftwareAttr
+	if err := software.GetFrom(&rfc5769SampleRequest); err != nil {
+		t.Fatal(err)
+	}
+	if software != "STUN test client" {
+		t.Errorf("expected STUN test client found %q", software)
+	}
+
+	var username UsernameAttr
+	var realm RealmAttr
+	var nonce NonceAttr
+	for _, g := range []Getter{&username, &realm, &nonce} {
+		if err := g.GetFrom(&rfc5769SampleRequestLongTermAuth); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if username != rfc5769LongTermUsername || realm != rfc5769LongTermRealm {
+		t.Errorf("expected %s@%s found %s@%s", rfc5769LongTermUsername, rfc5769LongTermRealm, username, realm)
+	}
+	if expected := "f//499k954d6OL34oL9FSTvy64sA"; string(nonce) != expected {
+		t.Errorf("expected nonce %s found %s", expected, nonce)
+	}
+
+	var msg Message
+	for _, s := range []Setter{username, realm, nonce, software} {
+		if err := s.AddTo(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, attr := range []AttrType{Username, Realm, Nonce, Software} {
+		expected, _ := rfc5769SampleRequestLongTermAuth.Get(attr)
+		if attr == Software {
+			expected, _ = rfc5769SampleRequest.Get(attr)
+		}
+		if found, _ := msg.Get(attr); !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %#v found %#v", expected, found)
+		}
+	}
+}
+
+func TestTextAttributeLimits(t *testing.T) {
+	for _, tcase := range []struct {
+		setter Setter
+		valid  bool
+	}{
+		{UsernameAttr(strings.Repeat("a", 512)), true},
+		{UsernameAttr(strings.Repeat("a", 513)), false},
+		{RealmAttr(strings.Repeat("a", 127)), true},
+		{RealmAttr(strings.Repeat("a", 128)), false},
+		// limit is in characters rather than bytes
+		{RealmAttr(strings.Repeat("マ", 127)), true},
+		{NonceAttr(strings.Repeat("a", 128)), false},
+		{SoftwareAttr(strings.Repeat("ß", 127)), true},
+		{SoftwareAttr(strings.Repeat("ß", 128)), false},
+		{SoftwareAttr("\xff"), false},
+	} {
+		msg := Message{}
+		err := tcase.setter.AddTo(&msg)
+		if tcase.valid && err != nil {
+			t.Errorf("%T: unexpected error %v", tcase.setter, err)
+		}
+		if !tcase.valid && (err != ErrBadText || len(msg.Attr) != 0) {
+			t.Errorf("%T: expected ErrBadText but %v found", tcase.setter, err)
+		}
+	}
+
+	msg := Message{Attr: []Attribute{{Type: Realm, Value: []byte(strings.Repeat("a", 128))}}}
+	var realm RealmAttr
+	if err := realm.GetFrom(&msg); err != ErrBadText {
+		t.Errorf("expected ErrBadText but %v found", err)
+	}
+}
+
+func TestErrorAttribute(t *testing.T) {
+	msg := Message{}
+	if err := ErrStaleNonce.AddTo(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var e Error
+	if err := e.GetFrom(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if e != ErrStaleNonce {
+		t.Errorf("expected %v found %v", ErrStaleNonce, e)
+	}
+
+	if err := (Error{Code: 700}).AddTo(&msg); err != ErrBadErrorCode {
+		t.Errorf("expected ErrBadErrorCode but %v found", err)
+	}
+}
+
+func TestAddressAttributes(t *testing.T) {
+	var xor XORMappedAddressAttr
+	if err := xor.GetFrom(&rfc5769SampleResponseIPv6); err != nil {
+		t.Fatal(err)
+	}
+	if xor.String() != rfc5769MappedAddrIPv6.String() {
+		t.Errorf("expected %s found %s", rfc5769MappedAddrIPv6, &xor)
+	}
+
+	msg := Message{ID: rfc5769SampleResponse.ID}
+	for _, s := range []Setter{
+		(*XORMappedAddressAttr)(rfc5769MappedAddr),
+		(*MappedAddressAttr)(rfc5769MappedAddr),
+		(*AlternateServerAttr)(rfc5769MappedAddrIPv6),
+	} {
+		if err := s.AddTo(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mapped MappedAddressAttr
+	var alternate AlternateServerAttr
+	for _, g := range []Getter{&xor, &mapped, &alternate} {
+		if err := g.GetFrom(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if xor.String() != rfc5769MappedAddr.String() || mapped.String() != rfc5769MappedAddr.String() {
+		t.Errorf("expected %s found %s and %s", rfc5769MappedAddr, &xor, &mapped)
+	}
+	if alternate.String() != rfc5769MappedAddrIPv6.String() {
+		t.Errorf("expected %s found %s", rfc5769MappedAddrIPv6, &alternate)
+	}
+
+	if err := (*AlternateServerAttr)(&net.UDPAddr{}).AddTo(&msg); err != ErrBadAddress {
+		t.Errorf("expected ErrBadAddress but %v found", err)
+	}
+}
+
+func TestUnknownAttributesAttribute(t *testing.T) {
+	msg := Message{}
+	if err := (UnknownAttributesAttr{Realm, 0x0031}).AddTo(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var unknown UnknownAttributesAttr
+	if err := unknown.GetFrom(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (UnknownAttributesAttr{Realm, 0x0031}); !reflect.DeepEqual(expected, unknown) {
+		t.Errorf("expected %v found %v", expected, unknown)
+	}
+}
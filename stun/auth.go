@@ -0,0 +1,327 @@
+package stun
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultNonceLifetime is the default duration a nonce issued by LongTermAuth is valid for
+const DefaultNonceLifetime = 10 * time.Minute
+
+// CredentialStore looks up the password of a user in a realm
+type CredentialStore interface {
+	Password(username, realm string) (password string, ok bool)
+}
+
+// CredentialStoreFunc is an adapter to allow the use of ordinary functions as credential stores
+type CredentialStoreFunc func(username, realm string) (string, bool)
+
+// Password calls f(username, realm)
+func (f CredentialStoreFunc) Password(username, realm string) (string, bool) {
+	return f(username, realm)
+}
+
+// UserHashStore is implemented by credential stores that can look up
+// the username of a USERHASH as described in RFC-8489 section-14.5
+type UserHashStore interface {
+	CredentialStore
+	User(userhash []byte, realm string) (username string, ok bool)
+}
+
+// LongTermAuth is a Handler that authenticates messages with the long-term
+// credential mechanism as described in RFC-5389 section-10.2.2 before passing
+// them to Handler. Unauthenticated requests are challenged with a 401 error
+// response carrying REALM and NONCE, as are requests for another realm, and
+// requests with an expired nonce are answered with 438. Unauthenticated indications are discarded.
+// Responses to authenticated requests are protected with the same integrity
+// attribute as the request, including the 420 error response to requests with
+// unknown comprehension-required attributes, which are only checked once the
+// request is authenticated as described in RFC-5389 section-7.3.
+//
+// The RFC-8489 security features are enabled with PasswordAlgorithms and
+// UserHash, in which case they are advertised in the nonce cookie.
+type LongTermAuth struct {
+	// Realm sent in the REALM attribute of challenges
+	Realm string
+	// Credentials used to look up the password of the USERNAME of a request
+	Credentials CredentialStore
+	// NonceLifetime is how long issued nonces are valid for.
+	// If zero, DefaultNonceLifetime is used.
+	NonceLifetime time.Duration
+	// Secret used to sign nonces so that they can be validated without keeping
+	// state. If empty, a random secret is generated on first use.
+	Secret []byte
+	// Handler to invoke for authenticated messages, DefaultServeMux if nil
+	Handler Handler
+	// PasswordAlgorithms, if not empty, enables the password algorithm negotiation
+	// as described in RFC-8489 section-9.2.4: challenges carry PASSWORD-ALGORITHMS
+	// and requests must echo them along with the chosen PASSWORD-ALGORITHM.
+	PasswordAlgorithms []Algorithm
+	// UserHash enables username anonymity as described in RFC-8489 section-9.2.4.
+	// Credentials must implement UserHashStore to look up the USERHASH of requests.
+	UserHash bool
+
+	once   sync.Once
+	secret []byte
+}
+
+func (a *LongTermAuth) init() {
+	a.once.Do(func() {
+		a.secret = a.Secret
+		if len(a.secret) == 0 {
+			a.secret = make([]byte, sha1.Size)
+			rand.Read(a.secret)
+		}
+	})
+}
+
+func (a *LongTermAuth) lifetime() time.Duration {
+	if a.NonceLifetime <= 0 {
+		return DefaultNonceLifetime
+	}
+	return a.NonceLifetime
+}
+
+// features returns the RFC-8489 security feature set advertised in nonces
+func (a *LongTermAuth) features() (features uint32) {
+	if len(a.PasswordAlgorithms) > 0 {
+		features |= featurePasswordAlgorithms
+	}
+	if a.UserHash {
+		features |= featureUsernameAnonymity
+	}
+	return
+}
+
+// nonceMAC signs the security features and expiration time
+// of a nonce issued in the realm to the client in addr
+func (a *LongTermAuth) nonceMAC(cookie, expiry []byte, addr string) []byte {
+	mac := hmac.New(sha1.New, a.secret)
+	mac.Write(cookie)
+	mac.Write(expiry)
+	mac.Write([]byte(a.Realm))
+	mac.Write([]byte{0})
+	mac.Write([]byte(addr))
+	return mac.Sum(nil)
+}
+
+// nonce returns a new nonce for the client in addr which is the nonce cookie,
+// if there are security features enabled, followed by its expiration time in
+// nanoseconds and its signature, hex encoded
+func (a *LongTermAuth) nonce(addr string) []byte {
+	var cookie []byte
+	if features := a.features(); features != 0 {
+		cookie = encodeNonceCookie(features)
+	}
+
+	var expiry [8]byte
+	t := uint64(time.Now().Add(a.lifetime()).UnixNano())
+	for i := range expiry {
+		expiry[i] = byte(t >> uint(56-8*i))
+	}
+
+	raw := append(expiry[:], a.nonceMAC(cookie, expiry[:], addr)...)
+	nonce := make([]byte, len(cookie)+hex.EncodedLen(len(raw)))
+	copy(nonce, cookie)
+	hex.Encode(nonce[len(cookie):], raw)
+
+	return nonce
+}
+
+// validNonce returns whether the nonce was issued in the realm to the client
+// in addr and has not expired yet, and the security features it advertises
+func (a *LongTermAuth) validNonce(nonce []byte, addr string) (features uint32, ok bool) {
+	var cookie []byte
+	if features, ok = decodeNonceCookie(nonce); ok {
+		cookie = nonce[:nonceCookieLen]
+		nonce = nonce[nonceCookieLen:]
+	}
+
+	raw := make([]byte, hex.DecodedLen(len(nonce)))
+	if _, err := hex.Decode(raw, nonce); err != nil || len(raw) != 8+sha1.Size {
+		return 0, false
+	}
+
+	expiry := raw[:8]
+	if !hmac.Equal(raw[8:], a.nonceMAC(cookie, expiry, addr)) {
+		return 0, false
+	}
+
+	var t uint64
+	for _, b := range expiry {
+		t = t<<8 | uint64(b)
+	}
+
+	return features, time.Now().UnixNano() < int64(t)
+}
+
+// challenge replies to the request with the given error, a REALM, a new NONCE
+// and the PASSWORD-ALGORITHMS supported by the server, if any
+func (a *LongTermAuth) challenge(w ResponseWriter, in *Incoming, e Error, addr string) {
+	if in.Class != Request {
+		return
+	}
+
+	resp := in.ErrorResponse(e)
+	resp.Set(Realm, []byte(a.Realm))
+	resp.Set(Nonce, a.nonce(addr))
+	if len(a.PasswordAlgorithms) > 0 {
+		resp.SetPasswordAlgorithms(a.PasswordAlgorithms)
+	}
+
+	w.WriteMessage(resp)
+}
+
+// badRequest replies to the request with a 400 error response
+func (a *LongTermAuth) badRequest(w ResponseWriter, in *Incoming) {
+	if in.Class == Request {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+	}
+}
+
+// algorithm returns the password algorithm of the request as described in
+// RFC-8489 section-9.2.4 or false if the request must be rejected. The
+// PASSWORD-ALGORITHMS attribute must match the ones of the server to prevent
+// bid-down attacks.
+func (a *LongTermAuth) algorithm(in *Incoming, features uint32) (alg Algorithm, ok bool) {
+	if features&featurePasswordAlgorithms == 0 {
+		return AlgorithmMD5, true
+	}
+
+	algs, errAlgs := in.PasswordAlgorithms()
+	alg, errAlg := in.PasswordAlgorithm()
+
+	switch {
+	case errAlgs == ErrAttrNotFound && errAlg == ErrAttrNotFound:
+		alg = AlgorithmMD5
+	case errAlgs != nil || errAlg != nil || len(algs) != len(a.PasswordAlgorithms):
+		return
+	default:
+		for i := range algs {
+			if algs[i] != a.PasswordAlgorithms[i] {
+				return
+			}
+		}
+	}
+
+	for _, supported := range a.PasswordAlgorithms {
+		if alg == supported && alg.Supported() {
+			return alg, true
+		}
+	}
+
+	return
+}
+
+// username returns the USERNAME of the request or the username
+// of its USERHASH if username anonymity is enabled
+func (a *LongTermAuth) username(in *Incoming, realm []byte, features uint32) (username string, found, ok bool) {
+	if userhash, err := in.Get(UserHash); err == nil && features&featureUsernameAnonymity != 0 {
+		store, isUserHashStore := a.Credentials.(UserHashStore)
+		if !isUserHashStore {
+			return
+		}
+
+		username, found = store.User(userhash, string(realm))
+		return username, found, true
+	}
+
+	value, err := in.Get(Username)
+	if err != nil {
+		return
+	}
+
+	return string(value), true, true
+}
+
+func (a *LongTermAuth) handler() Handler {
+	if a.Handler == nil {
+		return DefaultServeMux
+	}
+	return a.Handler
+}
+
+// ServeSTUN authenticates the message and passes it to Handler with
+// the long-term key set in in.Key
+func (a *LongTermAuth) ServeSTUN(w ResponseWriter, in *Incoming) {
+	a.init()
+
+	// nonces are bound to the client IP address
+	addr := in.RemoteAddr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	_, errSHA1 := in.Get(MessageIntegrity)
+	_, errSHA256 := in.Get(MessageIntegritySHA256)
+	if errSHA1 != nil && errSHA256 != nil {
+		a.challenge(w, in, ErrUnauthorized, addr)
+		return
+	}
+
+	realm, errRealm := in.Get(Realm)
+	nonce, errNonce := in.Get(Nonce)
+	if errRealm != nil || errNonce != nil {
+		a.badRequest(w, in)
+		return
+	}
+
+	if string(realm) != a.Realm {
+		a.challenge(w, in, ErrUnauthorized, addr)
+		return
+	}
+
+	features, ok := a.validNonce(nonce, addr)
+	if !ok {
+		a.challenge(w, in, ErrStaleNonce, addr)
+		return
+	}
+
+	alg, ok := a.algorithm(in, features)
+	if !ok {
+		a.badRequest(w, in)
+		return
+	}
+
+	username, found, ok := a.username(in, realm, features)
+	if !ok {
+		a.badRequest(w, in)
+		return
+	}
+
+	password, ok := a.Credentials.Password(username, string(realm))
+	if !found || !ok {
+		a.challenge(w, in, ErrUnauthorized, addr)
+		return
+	}
+
+	key := alg.Key(username, string(realm), password)
+
+	var err error
+	if errSHA256 == nil {
+		err = CheckIntegritySHA256(in.Raw, key)
+	} else {
+		err = CheckIntegrity(in.Raw, key)
+	}
+
+	if err != nil {
+		a.challenge(w, in, ErrUnauthorized, addr)
+		return
+	}
+
+	in.Key = key
+	in.IntegritySHA256 = errSHA256 == nil
+
+	// unknown attributes are checked once the request is authenticated
+	// so that the 420 error response is protected
+	if !checkUnknown(w, in) {
+		return
+	}
+
+	a.handler().ServeSTUN(w, in)
+}
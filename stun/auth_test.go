@@ -0,0 +1,213 @@
+package stun
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+var testCredentials = CredentialStoreFunc(func(username, realm string) (string, bool) {
+	if username == rfc5769LongTermUsername && realm == rfc5769LongTermRealm {
+		return rfc5769LongTermPassword, true
+	}
+	return "", false
+})
+
+// authenticatedRequest returns an encoded Binding request with long-term credentials
+func authenticatedRequest(t *testing.T, username, password string, nonce []byte) []byte {
+	id, err := NewTransactionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := Message{Class: Request, Method: Binding, ID: id}
+	msg.Set(Username, []byte(username))
+	msg.Set(Realm, []byte(rfc5769LongTermRealm))
+	msg.Set(Nonce, nonce)
+
+	data, err := Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return AddIntegrity(data, LongTermKey(username, rfc5769LongTermRealm, password))
+}
+
+func checkChallenge(t *testing.T, resp *Message, expected Error) []byte {
+	checkType(t, resp, Binding, ErrorResponse)
+
+	if e, _ := resp.ErrorCode(); e != expected {
+		t.Errorf("expected %v found %v", expected, e)
+	}
+	if realm, _ := resp.Get(Realm); string(realm) != rfc5769LongTermRealm {
+		t.Errorf("expected REALM %q found %q", rfc5769LongTermRealm, realm)
+	}
+
+	nonce, err := resp.Get(Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nonce
+}
+
+func TestLongTermAuth(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{Handler: &LongTermAuth{
+		Realm:       rfc5769LongTermRealm,
+		Credentials: testCredentials,
+	}})
+	defer pc.Close()
+	defer conn.Close()
+
+	data, err := Marshal(Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := exchange(t, pc, data)
+	nonce := checkChallenge(t, &resp, ErrUnauthorized)
+	if _, err := resp.Get(MessageIntegrity); err != ErrAttrNotFound {
+		t.Errorf("expected challenge without MESSAGE-INTEGRITY")
+	}
+
+	resp, _ = exchange(t, pc, authenticatedRequest(t, rfc5769LongTermUsername, "bad password", nonce))
+	checkChallenge(t, &resp, ErrUnauthorized)
+
+	resp, _ = exchange(t, pc, authenticatedRequest(t, "unknown", rfc5769LongTermPassword, nonce))
+	checkChallenge(t, &resp, ErrUnauthorized)
+
+	resp, _ = exchange(t, pc, authenticatedRequest(t, rfc5769LongTermUsername, rfc5769LongTermPassword, []byte("forged")))
+	checkChallenge(t, &resp, ErrStaleNonce)
+
+	data = authenticatedRequest(t, rfc5769LongTermUsername, rfc5769LongTermPassword, nonce)
+	resp, local := exchange(t, pc, data)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	if addr, _ := resp.XORMappedAddress(); addr.String() != local.String() {
+		t.Errorf("expected mapped address %s found %s", local, addr)
+	}
+
+	raw, err := Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+	if err := CheckIntegrity(raw, key); err != nil {
+		t.Errorf("expected response to be integrity protected: %v", err)
+	}
+}
+
+func TestLongTermAuthRealm(t *testing.T) {
+	anyRealm := CredentialStoreFunc(func(username, realm string) (string, bool) {
+		return rfc5769LongTermPassword, true
+	})
+	auth := &LongTermAuth{Realm: rfc5769LongTermRealm, Credentials: anyRealm, Secret: []byte("secret")}
+	other := &LongTermAuth{Realm: "other", Credentials: anyRealm, Secret: []byte("secret")}
+	auth.init()
+	other.init()
+
+	addr := "127.0.0.1"
+	if _, ok := other.validNonce(auth.nonce(addr), addr); ok {
+		t.Errorf("expected nonce to be bound to the realm")
+	}
+
+	conn, pc := serveTestServer(t, &Server{Handler: auth})
+	defer pc.Close()
+	defer conn.Close()
+
+	data, err := Marshal(Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := exchange(t, pc, data)
+	nonce := checkChallenge(t, &resp, ErrUnauthorized)
+
+	msg := Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID}
+	msg.Set(Username, []byte(rfc5769LongTermUsername))
+	msg.Set(Realm, []byte("other"))
+	msg.Set(Nonce, nonce)
+	if data, err = Marshal(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	data = AddIntegrity(data, LongTermKey(rfc5769LongTermUsername, "other", rfc5769LongTermPassword))
+	resp, _ = exchange(t, pc, data)
+	checkChallenge(t, &resp, ErrUnauthorized)
+}
+
+func TestLongTermAuthUnknownAttributes(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{Handler: &LongTermAuth{
+		Realm:       rfc5769LongTermRealm,
+		Credentials: testCredentials,
+	}})
+	defer pc.Close()
+	defer conn.Close()
+
+	// unauthenticated requests are challenged before checking their attributes
+	req := Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID, Attr: rfc5769SampleRequest.Attr[:3]}
+	data, err := Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := exchange(t, pc, data)
+	checkChallenge(t, &resp, ErrUnauthorized)
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the 420 error response is protected and accepted by the client
+	req.ID = nil
+	if resp, err = client.Do(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrUnknownAttribute {
+		t.Errorf("expected %v found %v", ErrUnknownAttribute, e)
+	}
+	if _, err := resp.Get(MessageIntegrity); err != nil {
+		t.Errorf("expected 420 error response to be integrity protected")
+	}
+}
+
+func TestLongTermAuthStaleNonce(t *testing.T) {
+	auth := &LongTermAuth{
+		Realm:         rfc5769LongTermRealm,
+		Credentials:   testCredentials,
+		NonceLifetime: time.Millisecond,
+	}
+	auth.init()
+
+	addr := "127.0.0.1"
+	nonce := auth.nonce(addr)
+	if _, ok := auth.validNonce(nonce, addr); !ok {
+		t.Errorf("expected nonce to be valid")
+	}
+	if _, ok := auth.validNonce(nonce, "127.0.0.2"); ok {
+		t.Errorf("expected nonce to be bound to the client address")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := auth.validNonce(nonce, addr); ok {
+		t.Errorf("expected nonce to expire")
+	}
+
+	conn, pc := serveTestServer(t, &Server{Handler: auth})
+	defer pc.Close()
+	defer conn.Close()
+
+	nonce = auth.nonce(pc.LocalAddr().(*net.UDPAddr).IP.String())
+	time.Sleep(2 * time.Millisecond)
+
+	resp, _ := exchange(t, pc, authenticatedRequest(t, rfc5769LongTermUsername, rfc5769LongTermPassword, nonce))
+	if fresh := checkChallenge(t, &resp, ErrStaleNonce); string(fresh) == string(nonce) {
+		t.Errorf("expected a new nonce")
+	}
+}
@@ -0,0 +1,140 @@
+package stun
+
+import (
+	"fmt"
+)
+
+// ErrBadTransactionID is returned when a transaction ID
+// is not 16 bytes long including the magic cookie
+var ErrBadTransactionID = fmt.Errorf("bad transaction ID")
+
+// NewMessage returns a message of the given method and class with a new
+// random transaction ID, including the magic cookie, and the attributes
+// of the setters applied in order
+func NewMessage(method Method, class Class, setters ...Setter) (msg Message, err error) {
+	msg = Message{Method: method, Class: class}
+	if msg.ID, err = NewTransactionID(); err != nil {
+		return
+	}
+
+	for _, s := range setters {
+		if err = s.AddTo(&msg); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// builder holds the message and finalizers configured by the options of Build
+type builder struct {
+	msg             Message
+	integrity       []byte
+	integritySHA256 []byte
+	fingerprint     bool
+	setters         []Setter
+}
+
+// BuildOption configures the message encoded by Build
+type BuildOption func(b *builder) error
+
+// WithType sets the method and class of the message
+func WithType(method Method, class Class) BuildOption {
+	return func(b *builder) error {
+		b.msg.Method, b.msg.Class = method, class
+		return nil
+	}
+}
+
+// WithID sets the transaction ID of the message, which must include
+// the magic cookie, instead of a random one
+func WithID(id []byte) BuildOption {
+	return func(b *builder) error {
+		if len(id) != 16 {
+			return ErrBadTransactionID
+		}
+
+		b.msg.ID = id
+		return nil
+	}
+}
+
+// WithAttrs applies the attribute setters to the message in order
+// once its transaction ID is known
+func WithAttrs(setters ...Setter) BuildOption {
+	return func(b *builder) error {
+		b.setters = append(b.setters, setters...)
+		return nil
+	}
+}
+
+// WithIntegrity protects the message with a MESSAGE-INTEGRITY attribute computed
+// with the given key, which follows all the attributes set by WithAttrs
+func WithIntegrity(key []byte) BuildOption {
+	return func(b *builder) error {
+		b.integrity = key
+		return nil
+	}
+}
+
+// WithIntegritySHA256 protects the message with an untruncated MESSAGE-INTEGRITY-SHA256
+// attribute computed with the given key, which follows MESSAGE-INTEGRITY if any
+func WithIntegritySHA256(key []byte) BuildOption {
+	return func(b *builder) error {
+		b.integritySHA256 = key
+		return nil
+	}
+}
+
+// WithFingerprint appends a FINGERPRINT attribute as the last attribute of the message
+func WithFingerprint() BuildOption {
+	return func(b *builder) error {
+		b.fingerprint = true
+		return nil
+	}
+}
+
+// Build encodes the message configured by the options. A random transaction ID
+// is generated unless WithID is given. Regardless of the order of the options,
+// MESSAGE-INTEGRITY, MESSAGE-INTEGRITY-SHA256 and FINGERPRINT are appended in
+// this order after all the other attributes as described in RFC-8489 section-14.
+func Build(opts ...BuildOption) (data []byte, err error) {
+	var b builder
+	for _, opt := range opts {
+		if err = opt(&b); err != nil {
+			return
+		}
+	}
+
+	if b.msg.ID == nil {
+		if b.msg.ID, err = NewTransactionID(); err != nil {
+			return
+		}
+	}
+
+	for _, s := range b.setters {
+		if err = s.AddTo(&b.msg); err != nil {
+			return
+		}
+	}
+
+	if data, err = Marshal(b.msg); err != nil {
+		return
+	}
+
+	if b.integrity != nil {
+		data = AddIntegrity(data, b.integrity)
+	}
+
+	if b.integritySHA256 != nil {
+		if data, err = AddIntegritySHA256(data, b.integritySHA256, 0); err != nil {
+			return
+		}
+	}
+
+	if b.fingerprint {
+		data = AddFingerprint(data)
+	}
+
+	return
+}
@@ -0,0 +1,108 @@
+package stun
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMessage(t *testing.T) {
+	msg, err := NewMessage(Binding, Request, SoftwareAttr("STUN test client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &msg, Binding, Request)
+	if msg.IsLegacy() || len(msg.ID) != 16 {
+		t.Errorf("expected RFC-5389 transaction ID found %#v", msg.ID)
+	}
+
+	var software SoftwareAttr
+	if err := software.GetFrom(&msg); err != nil || software != "STUN test client" {
+		t.Errorf("expected STUN test client found %q: %v", software, err)
+	}
+
+	if _, err := NewMessage(Binding, Request, RealmAttr("\xff")); err != ErrBadText {
+		t.Errorf("expected ErrBadText but %v found", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	key := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+
+	var nonce NonceAttr
+	if err := nonce.GetFrom(&rfc5769SampleRequestLongTermAuth); err != nil {
+		t.Fatal(err)
+	}
+
+	// finalizers come before the attributes to check they are reordered
+	data, err := Build(
+		WithIntegrity(key),
+		WithType(Binding, Request),
+		WithID(rfc5769SampleRequestLongTermAuth.ID),
+		WithAttrs(UsernameAttr(rfc5769LongTermUsername), nonce, RealmAttr(rfc5769LongTermRealm)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rfc5769SampleRequestLongTermAuthBytes, data) {
+		t.Errorf("expected %#v found %#v", rfc5769SampleRequestLongTermAuthBytes, data)
+	}
+
+	// XOR-MAPPED-ADDRESS is encoded with the ID given after it
+	if data, err = Build(
+		WithAttrs((*XORMappedAddressAttr)(rfc5769MappedAddr)),
+		WithType(Binding, SuccessResponse),
+		WithID(rfc5769SampleResponse.ID),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := msg.XORMappedAddress(); err != nil || addr.String() != rfc5769MappedAddr.String() {
+		t.Errorf("expected %s found %s (%v)", rfc5769MappedAddr, addr, err)
+	}
+}
+
+func TestBuildFinalizers(t *testing.T) {
+	key := ShortTermKey(rfc5769Password)
+
+	data, err := Build(
+		WithFingerprint(),
+		WithIntegritySHA256(key),
+		WithType(Binding, Indication),
+		WithIntegrity(key),
+		WithAttrs(SoftwareAttr("gortc")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := UnmarshalStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &msg, Binding, Indication)
+	var types []AttrType
+	for _, a := range msg.Attr {
+		types = append(types, a.Type)
+	}
+	if expected := []AttrType{Software, MessageIntegrity, MessageIntegritySHA256, FingerPrint}; !reflect.DeepEqual(expected, types) {
+		t.Errorf("expected %v found %v", expected, types)
+	}
+
+	if err := CheckIntegrity(data, key); err != nil {
+		t.Error(err)
+	}
+	if err := CheckIntegritySHA256(data, key); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Build(WithID(make([]byte, 12))); err != ErrBadTransactionID {
+		t.Errorf("expected ErrBadTransactionID but %v found", err)
+	}
+}
@@ -0,0 +1,426 @@
+package stun
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// default retransmission parameters as described in RFC-5389 section-7.2.1
+const (
+	// DefaultRTO is the initial retransmission timeout
+	DefaultRTO = 500 * time.Millisecond
+	// DefaultRc is the maximum number of times a request is sent
+	DefaultRc = 7
+	// DefaultRm is the multiple of the initial RTO to wait for
+	// a response after the last request is sent
+	DefaultRm = 16
+)
+
+// DefaultMaxRedirects is the maximum number of ALTERNATE-SERVER
+// redirections followed by a transaction
+const DefaultMaxRedirects = 3
+
+var (
+	// ErrTimeout is returned when no response is received for a transaction
+	ErrTimeout = fmt.Errorf("transaction timed out")
+	// ErrRedirectLoop is returned when a server redirects a transaction
+	// to a server it has already been sent to
+	ErrRedirectLoop = fmt.Errorf("redirect loop")
+	// ErrTooManyRedirects is returned when a transaction is redirected
+	// more than MaxRedirects times
+	ErrTooManyRedirects = fmt.Errorf("too many redirects")
+)
+
+// NewTransactionID returns the magic cookie followed by
+// a cryptographically random 96-bit transaction ID
+func NewTransactionID() (id []byte, err error) {
+	id = make([]byte, 16)
+	copy(id, magicCookie[:])
+	_, err = rand.Read(id[4:])
+	return
+}
+
+// Client performs STUN transactions over a Conn retransmitting
+// requests over UDP as described in RFC-5389 section-7.2.1.
+// Over reliable transports requests are sent once and the transaction
+// times out after ReliableTimeout as described in RFC-5389 section-7.2.2.
+type Client struct {
+	// Conn is the connection to the server. Once a transaction is redirected,
+	// subsequent transactions are sent to the alternate server until Close.
+	Conn *Conn
+	// RTO is the initial retransmission timeout which is doubled after
+	// each retransmission. If zero, DefaultRTO is used.
+	RTO time.Duration
+	// Rc is the maximum number of times a request is sent.
+	// If zero, DefaultRc is used.
+	Rc int
+	// Rm is the multiple of RTO to wait for a response after
+	// the last request is sent. If zero, DefaultRm is used.
+	Rm int
+	// ReliableTimeout is the transaction timeout over reliable transports.
+	// If zero, DefaultReliableTimeout is used.
+	ReliableTimeout time.Duration
+	// Username and Password are the long-term credentials used to
+	// answer 401 and 438 challenges as described in RFC-5389 section-10.2.3.
+	// The password is expected to be already processed with SASLprep.
+	Username string
+	Password string
+	// MaxRedirects is the maximum number of 300 responses with an ALTERNATE-SERVER
+	// followed by a transaction. If zero, DefaultMaxRedirects is used. If negative,
+	// redirections are not followed and the 300 response is returned.
+	MaxRedirects int
+
+	mu sync.Mutex
+	// current is the connection to the alternate server, if redirected
+	current    *Conn
+	realm      []byte
+	nonce      []byte
+	algorithms []Algorithm
+}
+
+// maximum number of times a request is sent with new credentials
+// after a challenge
+const maxAuthAttempts = 2
+
+// NewClient returns a Client that uses the default retransmission parameters
+func NewClient(conn *Conn) *Client {
+	return &Client{Conn: conn}
+}
+
+func (c *Client) params() (rto time.Duration, rc, rm int) {
+	return retransmission(c.RTO, c.Rc, c.Rm)
+}
+
+// retransmission returns the given retransmission parameters
+// replacing the unset ones with the defaults
+func retransmission(rto time.Duration, rc, rm int) (time.Duration, int, int) {
+	if rto <= 0 {
+		rto = DefaultRTO
+	}
+	if rc <= 0 {
+		rc = DefaultRc
+	}
+	if rm <= 0 {
+		rm = DefaultRm
+	}
+	return rto, rc, rm
+}
+
+func (c *Client) maxRedirects() int {
+	if c.MaxRedirects == 0 {
+		return DefaultMaxRedirects
+	}
+	return c.MaxRedirects
+}
+
+func (c *Client) conn() *Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connLocked()
+}
+
+func (c *Client) connLocked() *Conn {
+	if c.current != nil {
+		return c.current
+	}
+	return c.Conn
+}
+
+// Close closes the connection to the alternate server the client was redirected
+// to, if any, so that subsequent transactions are sent over Conn. Conn is not closed.
+func (c *Client) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil {
+		err = c.current.Close()
+		c.current = nil
+	}
+	return
+}
+
+// alternate returns the ALTERNATE-SERVER of a 300 error response
+func alternate(resp *Message) (addr *net.UDPAddr, ok bool) {
+	if resp.Class != ErrorResponse {
+		return
+	}
+
+	if e, err := resp.ErrorCode(); err != nil || e.Code != ErrTryAlternateServer.Code {
+		return
+	}
+
+	addr, err := resp.AlternateServer()
+	return addr, err == nil
+}
+
+// redirect connects to the alternate server over the transport of conn and
+// sends the subsequent transactions to it. Connections to previous alternate
+// servers are closed, but not Conn. The credentials of the previous server
+// are discarded as the alternate server issues its own challenge.
+func (c *Client) redirect(conn *Conn, addr *net.UDPAddr) error {
+	next, err := conn.dial(addr.String())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another transaction already followed a redirection
+	if c.connLocked() != conn {
+		next.Close()
+		return nil
+	}
+
+	if c.current != nil {
+		c.current.Close()
+	}
+	c.current = next
+	c.realm, c.nonce, c.algorithms = nil, nil, nil
+
+	return nil
+}
+
+// credentials returns the cached REALM, NONCE and PASSWORD-ALGORITHMS of the last challenge
+func (c *Client) credentials() (realm, nonce []byte, algs []Algorithm) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.realm, c.nonce, c.algorithms
+}
+
+// authenticate adds the long-term credentials to the request and returns the function
+// that adds the integrity attribute to the encoded request and the key used, or nil
+// if there are no credentials or no challenge has been received yet. If the nonce has
+// an RFC-8489 nonce cookie, the advertised security features are used and the request
+// is protected with MESSAGE-INTEGRITY-SHA256.
+func (c *Client) authenticate(req *Message) (protect func([]byte) []byte, key []byte) {
+	realm, nonce, algs := c.credentials()
+	if c.Username == "" || realm == nil {
+		return
+	}
+
+	features, isCookie := decodeNonceCookie(nonce)
+
+	alg := AlgorithmMD5
+	if features&featurePasswordAlgorithms != 0 {
+		// the first algorithm supported by the client is used
+		for _, a := range algs {
+			if a.Supported() {
+				alg = a
+				break
+			}
+		}
+		req.SetPasswordAlgorithms(algs)
+		req.SetPasswordAlgorithm(alg)
+	}
+
+	if features&featureUsernameAnonymity != 0 {
+		req.Set(UserHash, NewUserHash(c.Username, string(realm)))
+	} else {
+		req.Set(Username, []byte(c.Username))
+	}
+	req.Set(Realm, realm)
+	req.Set(Nonce, nonce)
+
+	key = alg.Key(c.Username, string(realm), c.Password)
+	if isCookie {
+		protect = func(data []byte) []byte {
+			data, _ = AddIntegritySHA256(data, key, 0)
+			return data
+		}
+		return
+	}
+
+	protect = func(data []byte) []byte {
+		return AddIntegrity(data, key)
+	}
+	return
+}
+
+// authentic returns whether the response to a request protected with key has
+// a valid MESSAGE-INTEGRITY-SHA256 or MESSAGE-INTEGRITY attribute as described
+// in RFC-5389 section-10.2.3. The 401 and 438 challenges are never protected.
+func authentic(resp *received, key []byte) bool {
+	if e, err := resp.msg.ErrorCode(); err == nil && resp.msg.Class == ErrorResponse &&
+		(e == ErrUnauthorized || e == ErrStaleNonce) {
+		return true
+	}
+
+	if _, err := resp.msg.Get(MessageIntegritySHA256); err == nil {
+		return CheckIntegritySHA256(resp.raw, key) == nil
+	}
+
+	return CheckIntegrity(resp.raw, key) == nil
+}
+
+// challenged caches the REALM and NONCE of the challenge in resp
+// and returns whether the request should be sent again. A challenge
+// whose nonce cookie advertises password algorithms without the
+// PASSWORD-ALGORITHMS attribute is rejected as described in RFC-8489
+// section-9.2.5 as it could bid the client down to MD5.
+func (c *Client) challenged(resp *Message) bool {
+	if c.Username == "" || resp.Class != ErrorResponse {
+		return false
+	}
+
+	if e, err := resp.ErrorCode(); err != nil || (e != ErrUnauthorized && e != ErrStaleNonce) {
+		return false
+	}
+
+	realm, err := resp.Get(Realm)
+	if err != nil {
+		return false
+	}
+	nonce, err := resp.Get(Nonce)
+	if err != nil {
+		return false
+	}
+	algs, err := resp.PasswordAlgorithms()
+	if features, _ := decodeNonceCookie(nonce); features&featurePasswordAlgorithms != 0 && err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	c.realm, c.nonce, c.algorithms = realm, nonce, algs
+	c.mu.Unlock()
+
+	return true
+}
+
+// Do sends the request in req and returns the response with the same
+// transaction ID. If req has no ID, a new one is generated with NewTransactionID.
+// The request is retransmitted until a response is received, ctx is done or
+// the transaction times out, in which case ErrTimeout is returned.
+//
+// If the client has long-term credentials, requests are sent with the
+// USERNAME, REALM, NONCE and MESSAGE-INTEGRITY attributes once a REALM and
+// NONCE are known, and 401 or 438 error responses are retried in a new
+// transaction with the REALM and NONCE of the challenge. The nonce is cached
+// for subsequent transactions. The RFC-8489 password algorithms and username
+// anonymity are used when advertised by the server. Responses to authenticated
+// requests without a valid integrity attribute, other than the challenges,
+// are discarded.
+//
+// A 300 error response with an ALTERNATE-SERVER is retried in a new transaction
+// with the alternate server over the same transport as described in RFC-5389
+// section-11, which is used instead of Conn for subsequent transactions until
+// Close. As described in RFC-8489 section-10, the 300 response to an authenticated
+// request is only followed if its integrity is valid. ErrRedirectLoop is returned
+// if the alternate server was already tried by the transaction and
+// ErrTooManyRedirects if it is redirected more than MaxRedirects times.
+func (c *Client) Do(ctx context.Context, req Message) (resp Message, err error) {
+	attrs := req.Attr
+	redirects := 0
+	visited := make(map[string]bool)
+
+	for attempt := 0; ; {
+		// do not modify the attributes of the caller
+		req.Attr = append([]Attribute(nil), attrs...)
+		protect, key := c.authenticate(&req)
+		conn := c.conn()
+
+		if resp, err = c.roundTrip(ctx, conn, req, protect, key); err != nil {
+			return
+		}
+
+		if addr, ok := alternate(&resp); ok && c.maxRedirects() > 0 {
+			visited[conn.RemoteAddr().String()] = true
+			switch {
+			case visited[addr.String()]:
+				err = ErrRedirectLoop
+				return
+			case redirects == c.maxRedirects():
+				err = ErrTooManyRedirects
+				return
+			}
+
+			redirects++
+			if err = c.redirect(conn, addr); err != nil {
+				return
+			}
+		} else if attempt == maxAuthAttempts || !c.challenged(&resp) {
+			return
+		} else {
+			attempt++
+		}
+
+		// a challenge or a redirection is retried in a new transaction
+		req.ID = nil
+	}
+}
+
+// roundTrip performs a single transaction adding the integrity attribute
+// to the encoded request with protect if it is not nil. Responses to
+// a request protected with key that are not authentic are discarded.
+func (c *Client) roundTrip(ctx context.Context, conn *Conn, req Message, protect func([]byte) []byte, key []byte) (resp Message, err error) {
+	if req.ID == nil {
+		if req.ID, err = NewTransactionID(); err != nil {
+			return
+		}
+	}
+
+	var data []byte
+	if data, err = Marshal(req); err != nil {
+		return
+	}
+
+	if protect != nil {
+		data = protect(data)
+	}
+
+	ch := conn.register(req.ID)
+	defer conn.unregister(req.ID)
+
+	rto, rc, rm := c.params()
+	wait := rto
+
+	if conn.stream {
+		rc, wait = 1, c.ReliableTimeout
+		if wait <= 0 {
+			wait = DefaultReliableTimeout
+		}
+	}
+
+	for i := 0; i < rc; i++ {
+		if _, err = conn.Write(data); err != nil {
+			return
+		}
+
+		if i == rc-1 && !conn.stream {
+			wait = rto * time.Duration(rm)
+		}
+
+		timer := time.NewTimer(wait)
+	receive:
+		for {
+			select {
+			case r := <-ch:
+				if key != nil && !authentic(&r, key) {
+					continue
+				}
+				timer.Stop()
+				resp = r.msg
+				return
+			case <-ctx.Done():
+				timer.Stop()
+				err = ctx.Err()
+				return
+			case <-conn.done:
+				timer.Stop()
+				err = net.ErrClosed
+				return
+			case <-timer.C:
+				break receive
+			}
+		}
+
+		wait *= 2
+	}
+
+	err = ErrTimeout
+	return
+}
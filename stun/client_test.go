@@ -0,0 +1,216 @@
+package stun
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewTransactionID(t *testing.T) {
+	a, err := NewTransactionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewTransactionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a) != 16 || !isMagicCookie(a[:4]) {
+		t.Errorf("expected magic cookie followed by 96-bit ID but %#v found", a)
+	}
+	if bytes.Equal(a, b) {
+		t.Errorf("expected transaction IDs to be random")
+	}
+}
+
+func TestClientRetransmit(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	ids := make(chan []byte, DefaultRc)
+	go func() {
+		buf := make([]byte, maxpacket)
+		for i := 0; ; i++ {
+			n, addr, err := peer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, _ := Unmarshal(buf[:n])
+			ids <- req.ID
+
+			// drop the first two requests
+			if i == 2 {
+				resp, _ := bindingResponse(&req, conn.LocalAddr().(*net.UDPAddr))
+				data, _ := Marshal(resp)
+				peer.WriteTo(data, addr)
+			}
+		}
+	}()
+
+	client := &Client{Conn: conn, RTO: 10 * time.Millisecond}
+	resp, err := client.Do(context.Background(), Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	first := <-ids
+	for i := 0; i < 2; i++ {
+		if id := <-ids; !bytes.Equal(first, id) {
+			t.Errorf("expected retransmission with ID %#v found %#v", first, id)
+		}
+	}
+	if !bytes.Equal(first, resp.ID) {
+		t.Errorf("expected response with ID %#v found %#v", first, resp.ID)
+	}
+}
+
+func TestClientForgedResponse(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	key := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+	go func() {
+		buf := make([]byte, maxpacket)
+		n, addr, err := peer.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, _ := Unmarshal(buf[:n])
+
+		// an unprotected response is sent before the authentic one
+		forged, _ := bindingResponse(&req, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1})
+		data, _ := Marshal(forged)
+		peer.WriteTo(data, addr)
+
+		resp, _ := bindingResponse(&req, conn.LocalAddr().(*net.UDPAddr))
+		data, _ = Marshal(resp)
+		peer.WriteTo(AddIntegrity(data, key), addr)
+	}()
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+		realm:    []byte(rfc5769LongTermRealm),
+		nonce:    []byte("nonce"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, _ := resp.XORMappedAddress(); addr.String() != conn.LocalAddr().String() {
+		t.Errorf("expected mapped address %s found %s", conn.LocalAddr(), addr)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	count := make(chan int)
+	go func() {
+		buf := make([]byte, maxpacket)
+		n := 0
+		for {
+			peer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if _, _, err := peer.ReadFrom(buf); err != nil {
+				count <- n
+				return
+			}
+			n++
+		}
+	}()
+
+	client := &Client{Conn: conn, RTO: time.Millisecond, Rc: 3, Rm: 2}
+	start := time.Now()
+	if _, err := client.Do(context.Background(), Message{Class: Request, Method: Binding}); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout but %v found", err)
+	}
+
+	// 0, 1ms, 3ms and timeout at 3ms + 2 * 1ms
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("expected transaction to last at least 5ms but %v found", elapsed)
+	}
+	if n := <-count; n != 3 {
+		t.Errorf("expected 3 requests but %d found", n)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := NewClient(conn).Do(ctx, Message{Class: Request, Method: Binding}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded but %v found", err)
+	}
+}
+
+func TestClientLongTermCredentials(t *testing.T) {
+	auth := &LongTermAuth{
+		Realm:       rfc5769LongTermRealm,
+		Credentials: testCredentials,
+	}
+	conn, pc := serveTestServer(t, &Server{Handler: auth})
+	defer pc.Close()
+	defer conn.Close()
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	_, nonce, _ := client.credentials()
+	if nonce == nil {
+		t.Fatalf("expected nonce to be cached")
+	}
+
+	// cached nonce is reused
+	if resp, err = client.Do(ctx, Message{Class: Request, Method: Binding}); err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+	if _, found, _ := client.credentials(); string(found) != string(nonce) {
+		t.Errorf("expected nonce %q to be reused but %q found", nonce, found)
+	}
+
+	// stale nonce is replaced
+	client.nonce = []byte("stale")
+	if resp, err = client.Do(ctx, Message{Class: Request, Method: Binding}); err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	client.Password = "bad password"
+	if resp, err = client.Do(ctx, Message{Class: Request, Method: Binding}); err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrUnauthorized {
+		t.Errorf("expected %v found %v", ErrUnauthorized, e)
+	}
+}
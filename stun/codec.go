@@ -0,0 +1,115 @@
+package stun
+
+import (
+	"io"
+)
+
+// Decoder reads and decodes STUN messages from a stream-oriented transport
+// such as TCP or TLS, using the length field of their header to frame them
+// as described in RFC-5389 section-7.2.2
+type Decoder struct {
+	r   io.Reader
+	buf []byte
+	err error
+}
+
+// NewDecoder returns a new decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// frame reads exactly one STUN message from the stream into the decoder buffer
+// reassembling partial reads. Once the stream is out of sync, because part of
+// a message has been read, the same error is returned by subsequent calls.
+// Errors at a message boundary, such as a read deadline, are not kept.
+func (dec *Decoder) frame() (data []byte, err error) {
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	var n int
+	if data, n, err = dec.readFrame(); err != nil && n > 0 {
+		dec.err = err
+	}
+
+	return
+}
+
+// readFrame reads one STUN message and returns the number of bytes
+// consumed from the stream
+func (dec *Decoder) readFrame() (data []byte, n int, err error) {
+	var header [20]byte
+	if n, err = io.ReadFull(dec.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrIncomplete
+		}
+		return
+	}
+
+	if header[0]>>6 != 0 {
+		err = ErrNoStun
+		return
+	}
+
+	length := 20 + int(uint16(header[2])<<8|uint16(header[3]))
+	if cap(dec.buf) < length {
+		dec.buf = make([]byte, length)
+	}
+
+	data = dec.buf[:length]
+	copy(data, header[:])
+
+	var m int
+	m, err = io.ReadFull(dec.r, data[20:])
+	n += m
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrIncomplete
+		}
+		return nil, n, err
+	}
+
+	return
+}
+
+// Decode reads the next STUN message from the input and stores it in msg
+// reusing the capacity of its attributes as Message.Decode does. The ID and
+// attribute values of msg reference the decoder buffer, which is reused, so
+// they are only valid until the next call to Decode.
+//
+// It returns io.EOF if the input ends at a message boundary, ErrIncomplete if
+// it ends in the middle of a message, ErrNoStun if the input is not a STUN
+// message and ErrMalformed if the attributes of the message cannot be decoded.
+// After ErrNoStun and ErrIncomplete the stream cannot be framed anymore and
+// the same error is returned by subsequent calls, as is any read error in the
+// middle of a message. Read errors at a message boundary, such as a timeout,
+// can be retried.
+func (dec *Decoder) Decode(msg *Message) (err error) {
+	var data []byte
+	if data, err = dec.frame(); err != nil {
+		return
+	}
+
+	return msg.Decode(data)
+}
+
+// Encoder encodes and writes STUN messages to a stream-oriented transport
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns a new encoder that writes to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the encoding of msg to the stream reusing the encoder buffer
+func (enc *Encoder) Encode(msg Message) (err error) {
+	if enc.buf, err = msg.AppendTo(enc.buf[:0]); err != nil {
+		return
+	}
+
+	_, err = enc.w.Write(enc.buf)
+	return
+}
@@ -0,0 +1,96 @@
+package stun
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoder(t *testing.T) {
+	var stream []byte
+	for _, tcase := range marshalTestcases {
+		// FINGERPRINT is checked by the decoder
+		stream = append(stream, rfc5769Padding(tcase.data)...)
+	}
+
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+	for _, tcase := range marshalTestcases {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tcase.msg, msg) {
+			t.Errorf("expected %#v found %#v", tcase.msg, msg)
+		}
+	}
+
+	var msg Message
+	if err := dec.Decode(&msg); err != io.EOF {
+		t.Errorf("expected io.EOF but %v found", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	malformed := append([]byte(nil), rfc5769SampleRequestLongTermAuthBytes...)
+	// USERNAME length overruns the message
+	malformed[23] = 0xff
+
+	for _, tcase := range []struct {
+		data []byte
+		err  error
+	}{
+		{rfc5769SampleRequestBytes[:10], ErrIncomplete},
+		{rfc5769SampleRequestBytes[:30], ErrIncomplete},
+		{rtcpPacket, ErrNoStun},
+		{malformed, ErrMalformed},
+	} {
+		dec := NewDecoder(bytes.NewReader(tcase.data))
+
+		var msg Message
+		if err := dec.Decode(&msg); err != tcase.err {
+			t.Errorf("expected %v but %v found", tcase.err, err)
+		}
+	}
+
+	// a timeout at a message boundary does not break the framing
+	empty, err := Marshal(Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := append(empty, rfc5769Padding(rfc5769SampleRequestBytes)...)
+	dec := NewDecoder(iotest.TimeoutReader(bytes.NewReader(stream)))
+	for _, expected := range []error{nil, iotest.ErrTimeout, nil} {
+		var msg Message
+		if err := dec.Decode(&msg); err != expected {
+			t.Errorf("expected %v but %v found", expected, err)
+		}
+	}
+
+	// stream cannot be framed after a non STUN message
+	dec = NewDecoder(bytes.NewReader(append(rtcpPacket, rfc5769SampleRequestBytes...)))
+	for i := 0; i < 2; i++ {
+		var msg Message
+		if err := dec.Decode(&msg); err != ErrNoStun {
+			t.Errorf("expected ErrNoStun but %v found", err)
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	var expected []byte
+	for _, tcase := range marshalTestcases {
+		if err := enc.Encode(tcase.msg); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, tcase.data...)
+	}
+
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Errorf("expected %#v found %#v", expected, buf.Bytes())
+	}
+}
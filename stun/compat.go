@@ -0,0 +1,174 @@
+package stun
+
+import (
+	"fmt"
+	"net"
+)
+
+// CHANGE-REQUEST flags as described in RFC-3489 section-11.2.4
+const (
+	changeIPFlag   byte = 0x04
+	changePortFlag byte = 0x02
+)
+
+// ErrBadChangeRequest is returned when a CHANGE-REQUEST
+// attribute has an invalid length
+var ErrBadChangeRequest = fmt.Errorf("bad change request attribute")
+
+// alternateKnownAttributes is the set of comprehension-required attributes
+// understood by a server with alternate addresses
+var alternateKnownAttributes = func() AttrSet {
+	known := AttrSet{
+		ResponseAddress: true,
+		ChangeAddress:   true,
+		Padding:         true,
+		ResponsePort:    true,
+	}
+	for t := range DefaultKnownAttributes {
+		known[t] = true
+	}
+	return known
+}()
+
+// ChangeRequest decodes the CHANGE-REQUEST attribute of the message
+// as described in RFC-3489 section-11.2.4 and RFC-5780 section-7.2
+func (msg *Message) ChangeRequest() (changeIP, changePort bool, err error) {
+	var value []byte
+	if value, err = msg.Get(ChangeAddress); err != nil {
+		return
+	}
+
+	if len(value) != 4 {
+		err = ErrBadChangeRequest
+		return
+	}
+
+	return value[3]&changeIPFlag != 0, value[3]&changePortFlag != 0, nil
+}
+
+// SetChangeRequest encodes the flags into the CHANGE-REQUEST attribute of the message
+func (msg *Message) SetChangeRequest(changeIP, changePort bool) {
+	value := make([]byte, 4)
+	if changeIP {
+		value[3] |= changeIPFlag
+	}
+	if changePort {
+		value[3] |= changePortFlag
+	}
+
+	msg.Set(ChangeAddress, value)
+}
+
+// ResponseAddress decodes the RESPONSE-ADDRESS attribute of the message
+// as described in RFC-3489 section-11.2.2
+func (msg *Message) ResponseAddress() (*net.UDPAddr, error) {
+	return msg.getAddr(ResponseAddress)
+}
+
+// SetResponseAddress encodes addr into the RESPONSE-ADDRESS attribute of the message
+func (msg *Message) SetResponseAddress(addr *net.UDPAddr) error {
+	return msg.setAddr(ResponseAddress, addr)
+}
+
+// SourceAddress decodes the SOURCE-ADDRESS attribute of the message
+// as described in RFC-3489 section-11.2.5
+func (msg *Message) SourceAddress() (*net.UDPAddr, error) {
+	return msg.getAddr(SourceAddress)
+}
+
+// SetSourceAddress encodes addr into the SOURCE-ADDRESS attribute of the message
+func (msg *Message) SetSourceAddress(addr *net.UDPAddr) error {
+	return msg.setAddr(SourceAddress, addr)
+}
+
+// ChangedAddress decodes the CHANGED-ADDRESS attribute of the message
+// as described in RFC-3489 section-11.2.3
+func (msg *Message) ChangedAddress() (*net.UDPAddr, error) {
+	return msg.getAddr(ChangedAddress)
+}
+
+// SetChangedAddress encodes addr into the CHANGED-ADDRESS attribute of the message
+func (msg *Message) SetChangedAddress(addr *net.UDPAddr) error {
+	return msg.setAddr(ChangedAddress, addr)
+}
+
+// ReflectedFrom decodes the REFLECTED-FROM attribute of the message
+// as described in RFC-3489 section-11.2.11
+func (msg *Message) ReflectedFrom() (*net.UDPAddr, error) {
+	return msg.getAddr(ReflectedFrom)
+}
+
+// SetReflectedFrom encodes addr into the REFLECTED-FROM attribute of the message
+func (msg *Message) SetReflectedFrom(addr *net.UDPAddr) error {
+	return msg.setAddr(ReflectedFrom, addr)
+}
+
+// emptyChangeRequest returns whether the message is an RFC-3489 message with a
+// CHANGE-REQUEST that asks to change neither the IP address nor the port, as sent
+// by classic clients in their first test, which can be ignored
+func emptyChangeRequest(msg *Message) bool {
+	changeIP, changePort, err := msg.ChangeRequest()
+	return msg.IsLegacy() && err == nil && !changeIP && !changePort
+}
+
+// classicAddr returns the local address addr if it can be sent to RFC-3489 clients,
+// which only understand IPv4 addresses as described in RFC-3489 section-11.2.1.
+// Unspecified addresses of sockets listening on every interface are left out.
+func classicAddr(addr net.Addr) (*net.UDPAddr, bool) {
+	a, ok := transportAddr(addr)
+	if !ok {
+		return nil, false
+	}
+
+	ip := a.IP.To4()
+	if ip == nil || ip.IsUnspecified() {
+		return nil, false
+	}
+
+	return &net.UDPAddr{IP: ip, Port: a.Port}, true
+}
+
+// AlternateResponseWriter is implemented by the ResponseWriter of a Server
+// serving a group of sockets on a primary and an alternate IP address and port
+// with ServeAlternate, so handlers can respond from another socket of the group
+type AlternateResponseWriter interface {
+	ResponseWriter
+	// AlternateAddr returns the local address of the socket of the group with
+	// the IP address and/or port changed from the one the message was received on
+	AlternateAddr(changeIP, changePort bool) net.Addr
+	// WriteMessageTo marshals and sends msg to addr from the socket of the group
+	// with the IP address and/or port changed from the one the message was received on
+	WriteMessageTo(msg Message, addr net.Addr, changeIP, changePort bool) error
+}
+
+// serveClassicBinding replies to an RFC-3489 Binding request received by a server
+// with alternate addresses. The response is sent to the RESPONSE-ADDRESS, if any,
+// from the socket selected by the CHANGE-REQUEST and includes the SOURCE-ADDRESS
+// and CHANGED-ADDRESS of the server as described in RFC-3489 section-8.1.
+func serveClassicBinding(w AlternateResponseWriter, in *Incoming, resp Message) {
+	changeIP, changePort, err := in.ChangeRequest()
+	if err != nil && err != ErrAttrNotFound {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+		return
+	}
+
+	to := in.RemoteAddr
+	if addr, err := in.ResponseAddress(); err == nil {
+		to = addr
+		if remote, ok := transportAddr(in.RemoteAddr); ok {
+			resp.SetReflectedFrom(remote)
+		}
+	} else if err != ErrAttrNotFound {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+		return
+	}
+
+	if source, ok := classicAddr(w.AlternateAddr(changeIP, changePort)); ok {
+		resp.SetSourceAddress(source)
+	}
+	if changed, ok := classicAddr(w.AlternateAddr(true, true)); ok {
+		resp.SetChangedAddress(changed)
+	}
+
+	w.WriteMessageTo(resp, to, changeIP, changePort)
+}
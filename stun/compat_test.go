@@ -0,0 +1,197 @@
+package stun
+
+import (
+	"net"
+	"testing"
+)
+
+// serveAlternateTestServer serves srv on 127.0.0.1 and 127.0.0.2
+func serveAlternateTestServer(t *testing.T, srv *Server) [2][2]net.PacketConn {
+	pcs, err := listenAlternate("udp", "127.0.0.1:0", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("alternate loopback address not available: %v", err)
+	}
+	go srv.ServeAlternate(pcs)
+
+	return pcs
+}
+
+func closeAlternates(pcs [2][2]net.PacketConn) {
+	for ip := range pcs {
+		for port := range pcs[ip] {
+			pcs[ip][port].Close()
+		}
+	}
+}
+
+func TestListenAndServeAlternateUnspecified(t *testing.T) {
+	for _, tcase := range []struct {
+		primary, alternate string
+	}{
+		{":0", "127.0.0.2:0"},
+		{"0.0.0.0:0", "127.0.0.2:0"},
+		{"127.0.0.1:0", "[::]:0"},
+	} {
+		if err := (&Server{}).ListenAndServeAlternate("udp", tcase.primary, tcase.alternate); err != ErrUnspecifiedAddress {
+			t.Errorf("expected ErrUnspecifiedAddress for %s and %s but %v found", tcase.primary, tcase.alternate, err)
+		}
+	}
+}
+
+func TestChangeRequest(t *testing.T) {
+	for _, tcase := range []struct {
+		changeIP, changePort bool
+	}{
+		{false, false}, {true, false}, {false, true}, {true, true},
+	} {
+		msg := Message{}
+		msg.SetChangeRequest(tcase.changeIP, tcase.changePort)
+
+		changeIP, changePort, err := msg.ChangeRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changeIP != tcase.changeIP || changePort != tcase.changePort {
+			t.Errorf("expected %v %v found %v %v", tcase.changeIP, tcase.changePort, changeIP, changePort)
+		}
+	}
+
+	msg := Message{Attr: []Attribute{{Type: ChangeAddress, Value: []byte{0x06}}}}
+	if _, _, err := msg.ChangeRequest(); err != ErrBadChangeRequest {
+		t.Errorf("expected ErrBadChangeRequest but %v found", err)
+	}
+}
+
+func TestServerClassicBinding(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, tcase := range []struct {
+		changeIP, changePort bool
+	}{
+		{false, false}, {true, false}, {false, true}, {true, true},
+	} {
+		req := Message{Class: Request, Method: Binding, ID: rfc3489SampleRequest.ID}
+		req.SetChangeRequest(tcase.changeIP, tcase.changePort)
+
+		writeMessage(t, client, req, pcs[0][0].LocalAddr())
+		resp, from := readMessage(t, client)
+		checkType(t, &resp, Binding, SuccessResponse)
+
+		expected := pcs[0][0].LocalAddr()
+		if tcase.changeIP || tcase.changePort {
+			ip, port := 0, 0
+			if tcase.changeIP {
+				ip = 1
+			}
+			if tcase.changePort {
+				port = 1
+			}
+			expected = pcs[ip][port].LocalAddr()
+		}
+
+		if from.String() != expected.String() {
+			t.Errorf("expected response from %s found %s", expected, from)
+		}
+
+		for _, attr := range []struct {
+			get      func() (*net.UDPAddr, error)
+			expected net.Addr
+		}{
+			{resp.MappedAddress, client.LocalAddr()},
+			{resp.SourceAddress, expected},
+			{resp.ChangedAddress, pcs[1][1].LocalAddr()},
+		} {
+			addr, err := attr.get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr.String() != attr.expected.String() {
+				t.Errorf("expected %s found %s", attr.expected, addr)
+			}
+		}
+	}
+}
+
+func TestServerClassicResponseAddress(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	target, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	req := Message{Class: Request, Method: Binding, ID: rfc3489SampleRequest.ID}
+	req.SetResponseAddress(target.LocalAddr().(*net.UDPAddr))
+	writeMessage(t, client, req, pcs[0][0].LocalAddr())
+
+	msg, _ := readMessage(t, target)
+	checkType(t, &msg, Binding, SuccessResponse)
+
+	addr, err := msg.ReflectedFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != client.LocalAddr().String() {
+		t.Errorf("expected REFLECTED-FROM %s found %s", client.LocalAddr(), addr)
+	}
+}
+
+func TestServerClassicWithoutAlternate(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	req := Message{Class: Request, Method: Binding, ID: rfc3489SampleRequest.ID}
+	data, _ := Marshal(req)
+	resp, _ := exchange(t, pc, data)
+	if addr, err := resp.SourceAddress(); err != nil || addr.String() != pc.LocalAddr().String() {
+		t.Errorf("expected SOURCE-ADDRESS %s found %s: %v", pc.LocalAddr(), addr, err)
+	}
+
+	// CHANGE-REQUEST without flags is ignored
+	req.SetChangeRequest(false, false)
+	data, _ = Marshal(req)
+	resp, _ = exchange(t, pc, data)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	// CHANGE-REQUEST is not understood
+	req.SetChangeRequest(true, true)
+	data, _ = Marshal(req)
+	resp, _ = exchange(t, pc, data)
+	if e, _ := resp.ErrorCode(); e != ErrUnknownAttribute {
+		t.Errorf("expected %v found %v", ErrUnknownAttribute, e)
+	}
+}
+
+func TestServerClassicUnspecifiedSource(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go (&Server{}).Serve(pc)
+
+	data, _ := Marshal(Message{Class: Request, Method: Binding, ID: rfc3489SampleRequest.ID})
+	resp, _ := exchange(t, pc, data)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	// the address the server listens on is not the one the response is sent from
+	if addr, err := resp.SourceAddress(); err != ErrAttrNotFound {
+		t.Errorf("expected no SOURCE-ADDRESS but %s found: %v", addr, err)
+	}
+}
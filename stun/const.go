@@ -2,45 +2,69 @@ package stun
 
 var magicCookie = [4]byte{0x21, 0x12, 0xa4, 0x42}
 
+// class bits C1 and C0 of the message type
 const stunTypeMask uint16 = 0x0110
 
 const (
 	Binding Method = 0x001
+
+	// TURN methods as described in RFC-5766 section-13
+	Allocate         Method = 0x003
+	Refresh          Method = 0x004
+	Send             Method = 0x006
+	Data             Method = 0x007
+	CreatePermission Method = 0x008
+	ChannelBind      Method = 0x009
 )
 
 const (
 	Request         Class = 0x000
-	Indication            = 0x010
-	SuccessResponse       = 0x100
-	ErrorResponse         = 0x110
+	Indication      Class = 0x010
+	SuccessResponse Class = 0x100
+	ErrorResponse   Class = 0x110
 )
 
 const (
 	MappedAddress     AttrType = 0x0001
-	Username                   = 0x0006
-	MessageIntegrity           = 0x0008
-	ErrorCode                  = 0x0009
-	UnknownAttributes          = 0x000A
-	Realm                      = 0x0014
-	Nonce                      = 0x0015
-	XORMappedAddress           = 0x0020
-	Software                   = 0x8022
-	AlternateServer            = 0x8023
-	FingerPrint                = 0x8028
+	Username          AttrType = 0x0006
+	MessageIntegrity  AttrType = 0x0008
+	ErrorCode         AttrType = 0x0009
+	UnknownAttributes AttrType = 0x000A
+	Realm             AttrType = 0x0014
+	Nonce             AttrType = 0x0015
+	XORMappedAddress  AttrType = 0x0020
+	Software          AttrType = 0x8022
+	AlternateServer   AttrType = 0x8023
+	FingerPrint       AttrType = 0x8028
+
+	// RFC-8489
+	MessageIntegritySHA256 AttrType = 0x001C
+	PasswordAlgorithm      AttrType = 0x001D
+	UserHash               AttrType = 0x001E
+	PasswordAlgorithms     AttrType = 0x8002
+
+	// RFC-5780
+	Padding        AttrType = 0x0026
+	ResponsePort   AttrType = 0x0027
+	ResponseOrigin AttrType = 0x802B
+	OtherAddress   AttrType = 0x802C
 
 	// legacy
-	ResponseAddress = 0x0002
-	ChangeAddress   = 0x0003
-	SourceAddress   = 0x0004
-	ChangedAddress  = 0x0005
-	Password        = 0x0007
+	ResponseAddress AttrType = 0x0002
+	// ChangeAddress is the CHANGE-REQUEST attribute
+	ChangeAddress  AttrType = 0x0003
+	SourceAddress  AttrType = 0x0004
+	ChangedAddress AttrType = 0x0005
+	Password       AttrType = 0x0007
+	ReflectedFrom  AttrType = 0x000B
 )
 
+// error codes as described in RFC-5389 section-15.6
 var (
-	ErrTryAlternateServer Error = Error{300, "Try Alternate Server"}
-	ErrBadRequest               = Error{400, "Bad Request"}
-	ErrUnauthorized             = Error{401, "Unauthorized"}
-	ErrStaleCredentials         = Error{420, "Unknown Attribute"}
-	ErrStaleNonce               = Error{438, "Stale Nonce"}
-	ErrServerError              = Error{500, "Server Error"}
+	ErrTryAlternateServer = Error{300, "Try Alternate"}
+	ErrBadRequest         = Error{400, "Bad Request"}
+	ErrUnauthorized       = Error{401, "Unauthorized"}
+	ErrUnknownAttribute   = Error{420, "Unknown Attribute"}
+	ErrStaleNonce         = Error{438, "Stale Nonce"}
+	ErrServerError        = Error{500, "Server Error"}
 )
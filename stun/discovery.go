@@ -0,0 +1,101 @@
+package stun
+
+import (
+	"fmt"
+	"net"
+)
+
+// ErrBadResponsePort is returned when a RESPONSE-PORT
+// attribute has an invalid length
+var ErrBadResponsePort = fmt.Errorf("bad response port attribute")
+
+// ResponseOrigin decodes the RESPONSE-ORIGIN attribute of the message
+// as described in RFC-5780 section-7.3
+func (msg *Message) ResponseOrigin() (*net.UDPAddr, error) {
+	return msg.getAddr(ResponseOrigin)
+}
+
+// SetResponseOrigin encodes addr into the RESPONSE-ORIGIN attribute of the message
+func (msg *Message) SetResponseOrigin(addr *net.UDPAddr) error {
+	return msg.setAddr(ResponseOrigin, addr)
+}
+
+// OtherAddress decodes the OTHER-ADDRESS attribute of the message
+// as described in RFC-5780 section-7.4
+func (msg *Message) OtherAddress() (*net.UDPAddr, error) {
+	return msg.getAddr(OtherAddress)
+}
+
+// SetOtherAddress encodes addr into the OTHER-ADDRESS attribute of the message
+func (msg *Message) SetOtherAddress(addr *net.UDPAddr) error {
+	return msg.setAddr(OtherAddress, addr)
+}
+
+// ResponsePort decodes the RESPONSE-PORT attribute of the message
+// as described in RFC-5780 section-7.5
+func (msg *Message) ResponsePort() (port int, err error) {
+	var value []byte
+	if value, err = msg.Get(ResponsePort); err != nil {
+		return
+	}
+
+	if len(value) != 4 {
+		err = ErrBadResponsePort
+		return
+	}
+
+	return int(uint16(value[0])<<8 | uint16(value[1])), nil
+}
+
+// SetResponsePort encodes port into the RESPONSE-PORT attribute of the message
+func (msg *Message) SetResponsePort(port int) {
+	msg.Set(ResponsePort, []byte{byte(port >> 8), byte(port), 0, 0})
+}
+
+// SetPadding sets a PADDING attribute of the given length in the message
+// as described in RFC-5780 section-7.6
+func (msg *Message) SetPadding(length int) {
+	msg.Set(Padding, make([]byte, length))
+}
+
+// serveDiscoveryBinding replies to a Binding request received by a server with
+// alternate addresses. The response is sent to the RESPONSE-PORT of the client, if
+// any, from the socket selected by the CHANGE-REQUEST, includes the RESPONSE-ORIGIN
+// and OTHER-ADDRESS of the server, and is padded as much as the request, as
+// described in RFC-5780 section-6.1. Requests with both PADDING and RESPONSE-PORT
+// are answered with a 400 error response.
+func serveDiscoveryBinding(w AlternateResponseWriter, in *Incoming, resp Message) {
+	changeIP, changePort, err := in.ChangeRequest()
+	if err != nil && err != ErrAttrNotFound {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+		return
+	}
+
+	padding, errPadding := in.Get(Padding)
+	to := in.RemoteAddr
+	if port, err := in.ResponsePort(); err == nil {
+		if errPadding == nil {
+			w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+			return
+		}
+
+		remote, _ := transportAddr(in.RemoteAddr)
+		to = &net.UDPAddr{IP: remote.IP, Port: port, Zone: remote.Zone}
+	} else if err != ErrAttrNotFound {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+		return
+	}
+
+	if errPadding == nil {
+		resp.SetPadding(len(padding))
+	}
+
+	if origin, ok := transportAddr(w.AlternateAddr(changeIP, changePort)); ok {
+		resp.SetResponseOrigin(origin)
+	}
+	if other, ok := transportAddr(w.AlternateAddr(true, true)); ok {
+		resp.SetOtherAddress(other)
+	}
+
+	w.WriteMessageTo(resp, to, changeIP, changePort)
+}
@@ -0,0 +1,124 @@
+package stun
+
+import (
+	"net"
+	"testing"
+)
+
+func TestServerDiscoveryBinding(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for ip := 0; ip < 2; ip++ {
+		for port := 0; port < 2; port++ {
+			req, err := NewMessage(Binding, Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetChangeRequest(ip == 1, port == 1)
+			req.SetPadding(100)
+
+			writeMessage(t, client, req, pcs[0][0].LocalAddr())
+			resp, from := readMessage(t, client)
+			checkType(t, &resp, Binding, SuccessResponse)
+
+			expected := pcs[ip][port].LocalAddr()
+			if from.String() != expected.String() {
+				t.Errorf("expected response from %s found %s", expected, from)
+			}
+
+			for _, attr := range []struct {
+				get      func() (*net.UDPAddr, error)
+				expected net.Addr
+			}{
+				{resp.XORMappedAddress, client.LocalAddr()},
+				{resp.ResponseOrigin, expected},
+				{resp.OtherAddress, pcs[1][1].LocalAddr()},
+			} {
+				addr, err := attr.get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if addr.String() != attr.expected.String() {
+					t.Errorf("expected %s found %s", attr.expected, addr)
+				}
+			}
+
+			if padding, err := resp.Get(Padding); err != nil || len(padding) != 100 {
+				t.Errorf("expected PADDING of 100 bytes found %d: %v", len(padding), err)
+			}
+		}
+	}
+}
+
+func TestServerResponsePort(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	other, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	req, err := NewMessage(Binding, Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetResponsePort(other.LocalAddr().(*net.UDPAddr).Port)
+	writeMessage(t, client, req, pcs[0][0].LocalAddr())
+
+	resp, _ := readMessage(t, other)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	// mapped address is still the source of the request
+	if addr, err := resp.XORMappedAddress(); err != nil || addr.String() != client.LocalAddr().String() {
+		t.Errorf("expected XOR-MAPPED-ADDRESS %s found %s: %v", client.LocalAddr(), addr, err)
+	}
+
+	// PADDING cannot be combined with RESPONSE-PORT
+	req.SetPadding(4)
+	writeMessage(t, client, req, pcs[0][0].LocalAddr())
+	resp, _ = readMessage(t, client)
+	if e, _ := resp.ErrorCode(); e != ErrBadRequest {
+		t.Errorf("expected %v found %v", ErrBadRequest, e)
+	}
+
+	req.Attr = req.Attr[:0]
+	req.Set(ResponsePort, []byte{0x01})
+	writeMessage(t, client, req, pcs[0][0].LocalAddr())
+	resp, _ = readMessage(t, client)
+	if e, _ := resp.ErrorCode(); e != ErrBadRequest {
+		t.Errorf("expected %v found %v", ErrBadRequest, e)
+	}
+}
+
+func TestServerDiscoveryWithoutAlternate(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	req, err := NewMessage(Binding, Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetResponsePort(3478)
+	data, _ := Marshal(req)
+
+	resp, _ := exchange(t, pc, data)
+	if e, _ := resp.ErrorCode(); e != ErrUnknownAttribute {
+		t.Errorf("expected %v found %v", ErrUnknownAttribute, e)
+	}
+}
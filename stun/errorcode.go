@@ -0,0 +1,104 @@
+package stun
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// maximum length in bytes of the reason phrase as described in RFC-5389 section-15.6
+const maxReasonLen = 763
+
+// ErrBadErrorCode is returned when an ERROR-CODE attribute
+// has an invalid code, length or reason phrase
+var ErrBadErrorCode = fmt.Errorf("bad error code attribute")
+
+func (e Error) valid() bool {
+	return e.Code >= 300 && e.Code <= 699 &&
+		len(e.Reason) <= maxReasonLen && utf8.ValidString(e.Reason)
+}
+
+// encodeError encodes e into an ERROR-CODE attribute value: 21 reserved bits,
+// the hundreds digit of the code in the class and the remainder in the number
+func encodeError(e Error) (value []byte, err error) {
+	if !e.valid() {
+		err = ErrBadErrorCode
+		return
+	}
+
+	value = make([]byte, 4+len(e.Reason))
+	value[2] = byte(e.Code / 100)
+	value[3] = byte(e.Code % 100)
+	copy(value[4:], e.Reason)
+
+	return
+}
+
+// decodeError is the inverse of encodeError
+func decodeError(value []byte) (e Error, err error) {
+	if len(value) < 4 {
+		err = ErrBadErrorCode
+		return
+	}
+
+	class := int(value[2] & 0x7)
+	number := int(value[3])
+	if number > 99 {
+		err = ErrBadErrorCode
+		return
+	}
+
+	e = Error{Code: class*100 + number, Reason: string(value[4:])}
+	if !e.valid() {
+		err = ErrBadErrorCode
+	}
+
+	return
+}
+
+// ErrorCode decodes the ERROR-CODE attribute of the message
+func (msg *Message) ErrorCode() (e Error, err error) {
+	var value []byte
+	if value, err = msg.Get(ErrorCode); err != nil {
+		return
+	}
+
+	return decodeError(value)
+}
+
+// SetErrorCode encodes e into the ERROR-CODE attribute of the message
+func (msg *Message) SetErrorCode(e Error) (err error) {
+	var value []byte
+	if value, err = encodeError(e); err != nil {
+		return
+	}
+
+	msg.Set(ErrorCode, value)
+	return
+}
+
+// Response returns an empty success response to the request in msg
+// with the same method and transaction ID
+func (msg *Message) Response() Message {
+	return Message{
+		Class:  SuccessResponse,
+		Method: msg.Method,
+		ID:     msg.ID,
+	}
+}
+
+// ErrorResponse returns an error response to the request in msg
+// with the same method and transaction ID and an ERROR-CODE attribute
+// encoding e. Invalid errors are replaced by ErrServerError.
+func (msg *Message) ErrorResponse(e Error) Message {
+	resp := Message{
+		Class:  ErrorResponse,
+		Method: msg.Method,
+		ID:     msg.ID,
+	}
+
+	if err := resp.SetErrorCode(e); err != nil {
+		resp.SetErrorCode(ErrServerError)
+	}
+
+	return resp
+}
@@ -0,0 +1,87 @@
+package stun
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, tcase := range []struct {
+		err   Error
+		value []byte
+	}{
+		{ErrTryAlternateServer, append([]byte{0x00, 0x00, 0x03, 0x00}, "Try Alternate"...)},
+		{ErrBadRequest, append([]byte{0x00, 0x00, 0x04, 0x00}, "Bad Request"...)},
+		{ErrUnauthorized, append([]byte{0x00, 0x00, 0x04, 0x01}, "Unauthorized"...)},
+		{ErrUnknownAttribute, append([]byte{0x00, 0x00, 0x04, 0x14}, "Unknown Attribute"...)},
+		{ErrStaleNonce, append([]byte{0x00, 0x00, 0x04, 0x26}, "Stale Nonce"...)},
+		{ErrServerError, append([]byte{0x00, 0x00, 0x05, 0x00}, "Server Error"...)},
+		{Error{699, ""}, []byte{0x00, 0x00, 0x06, 0x63}},
+	} {
+		var msg Message
+		if err := msg.SetErrorCode(tcase.err); err != nil {
+			t.Fatal(err)
+		}
+
+		value, _ := msg.Get(ErrorCode)
+		if !reflect.DeepEqual(tcase.value, value) {
+			t.Errorf("expected %#v found %#v", tcase.value, value)
+		}
+
+		e, err := msg.ErrorCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e != tcase.err {
+			t.Errorf("expected %v found %v", tcase.err, e)
+		}
+	}
+}
+
+func TestBadErrorCode(t *testing.T) {
+	var msg Message
+	for _, e := range []Error{
+		{299, "Too Low"},
+		{700, "Too High"},
+		{400, strings.Repeat("a", maxReasonLen+1)},
+		{400, "\xff"},
+	} {
+		if err := msg.SetErrorCode(e); err != ErrBadErrorCode {
+			t.Errorf("expected ErrBadErrorCode for %v but %v found", e, err)
+		}
+	}
+
+	for _, value := range [][]byte{
+		{0x00, 0x00, 0x04},
+		{0x00, 0x00, 0x04, 0x64},
+		{0x00, 0x00, 0x02, 0x00},
+	} {
+		msg = Message{Attr: []Attribute{{Type: ErrorCode, Value: value}}}
+		if _, err := msg.ErrorCode(); err != ErrBadErrorCode {
+			t.Errorf("expected ErrBadErrorCode for %#v but %v found", value, err)
+		}
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	resp := rfc5769SampleRequest.ErrorResponse(ErrUnauthorized)
+
+	checkType(t, &resp, Binding, ErrorResponse)
+	if !reflect.DeepEqual(resp.ID, rfc5769SampleRequest.ID) {
+		t.Errorf("expected transaction ID %#v found %#v", rfc5769SampleRequest.ID, resp.ID)
+	}
+
+	e, err := resp.ErrorCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != ErrUnauthorized {
+		t.Errorf("expected %v found %v", ErrUnauthorized, e)
+	}
+
+	var err2 error = e
+	if err2.Error() != "401 Unauthorized" {
+		t.Errorf("unexpected error string %q", err2.Error())
+	}
+}
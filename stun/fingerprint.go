@@ -0,0 +1,66 @@
+package stun
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// fingerprintXOR is XOR'd with the CRC-32 of the message
+// as described in RFC-5389 section-15.5
+const fingerprintXOR uint32 = 0x5354554e
+
+// length of the FINGERPRINT attribute value
+const fingerprintLen = 4
+
+// ErrFingerprint is returned when the FINGERPRINT attribute
+// of a packet does not match its CRC-32 or is not the last attribute
+var ErrFingerprint = fmt.Errorf("fingerprint mismatch")
+
+func fingerprintCRC(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data) ^ fingerprintXOR
+}
+
+func fingerprint(data []byte) []byte {
+	crc := fingerprintCRC(data)
+	return []byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)}
+}
+
+// AddFingerprint appends a FINGERPRINT attribute to the encoded STUN message in data
+// and adjusts the header length accordingly as described in RFC-5389 section-15.5.
+// No other attribute can be appended afterwards.
+func AddFingerprint(data []byte) []byte {
+	// length field includes the FINGERPRINT attribute
+	lengthField := uint16(len(data) - 20 + 4 + fingerprintLen)
+	data[2] = byte(lengthField >> 8)
+	data[3] = byte(lengthField)
+
+	return marshalAttr(data, Attribute{
+		Type:  FingerPrint,
+		Value: fingerprint(data),
+	})
+}
+
+// CheckFingerprint validates the FINGERPRINT attribute of the encoded STUN message
+// in data. It returns ErrAttrNotFound if the message has no FINGERPRINT and
+// ErrFingerprint if it is not the last attribute, is not 4 bytes long or does not match.
+func CheckFingerprint(data []byte) (err error) {
+	var offset int
+	if offset, err = findAttr(data, FingerPrint); err != nil {
+		return
+	}
+
+	end := 20 + int(uint16(data[2])<<8|uint16(data[3]))
+	length := int(uint16(data[offset+2])<<8 | uint16(data[offset+3]))
+	if length != fingerprintLen || offset+4+fingerprintLen != end {
+		err = ErrFingerprint
+		return
+	}
+
+	value := data[offset+4 : end]
+	found := uint32(value[0])<<24 | uint32(value[1])<<16 | uint32(value[2])<<8 | uint32(value[3])
+	if found != fingerprintCRC(data[:offset]) {
+		err = ErrFingerprint
+	}
+
+	return
+}
@@ -0,0 +1,69 @@
+package stun
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckFingerprint(t *testing.T) {
+	for _, data := range [][]byte{
+		rfc5769Padding(rfc5769SampleRequestBytes),
+		rfc5769Padding(rfc5769SampleResponseBytes),
+		rfc5769Padding(rfc5769SampleResponseIPv6Bytes),
+	} {
+		if err := CheckFingerprint(data); err != nil {
+			t.Errorf("expected fingerprint to be valid: %v", err)
+		}
+		if _, err := Unmarshal(data); err != nil {
+			t.Errorf("expected Unmarshal to succeed: %v", err)
+		}
+
+		corrupted := append([]byte(nil), data...)
+		corrupted[len(corrupted)-1] ^= 0xff
+		if err := CheckFingerprint(corrupted); err != ErrFingerprint {
+			t.Errorf("expected ErrFingerprint but %v found", err)
+		}
+		if _, err := Unmarshal(corrupted); err != ErrFingerprint {
+			t.Errorf("expected Unmarshal to return ErrFingerprint but %v found", err)
+		}
+
+		// a 2 bytes FINGERPRINT padded to 4 bytes
+		short := append([]byte(nil), data...)
+		short[len(short)-5] = 2
+		if err := CheckFingerprint(short); err != ErrFingerprint {
+			t.Errorf("expected ErrFingerprint for a short FINGERPRINT but %v found", err)
+		}
+	}
+
+	if err := CheckFingerprint(rfc5769SampleRequestLongTermAuthBytes); err != ErrAttrNotFound {
+		t.Errorf("expected ErrAttrNotFound but %v found", err)
+	}
+}
+
+func TestAddFingerprint(t *testing.T) {
+	expected := rfc5769Padding(rfc5769SampleResponseBytes)
+	data := AddFingerprint(append([]byte(nil), expected[:len(expected)-8]...))
+
+	if !reflect.DeepEqual(expected, data) {
+		t.Errorf("expected %#v found %#v", expected, data)
+	}
+}
+
+func TestFingerprintNotLast(t *testing.T) {
+	data, err := Marshal(Message{
+		Class:  Request,
+		Method: Binding,
+		ID:     rfc5769SampleRequest.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = AddFingerprint(data)
+	data = marshalAttr(data, Attribute{Type: Software, Value: []byte("test")})
+	data[3] += 8
+
+	if err := CheckFingerprint(data); err != ErrFingerprint {
+		t.Errorf("expected ErrFingerprint but %v found", err)
+	}
+}
@@ -0,0 +1,183 @@
+package stun
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// length of the HMAC-SHA1 value of the MESSAGE-INTEGRITY attribute
+const integrityLen = 20
+
+// length of the untruncated HMAC-SHA256 value of the MESSAGE-INTEGRITY-SHA256 attribute
+const integritySHA256Len = 32
+
+// ErrIntegrity is returned when the MESSAGE-INTEGRITY attribute
+// of a packet does not match the given key
+var ErrIntegrity = fmt.Errorf("message integrity mismatch")
+
+// ShortTermKey returns the key used to compute the MESSAGE-INTEGRITY
+// of a message using short-term credentials as described in RFC-5389 section-15.4.
+// The password is expected to be already processed with SASLprep.
+func ShortTermKey(password string) []byte {
+	return []byte(password)
+}
+
+// LongTermKey returns the key used to compute the MESSAGE-INTEGRITY
+// of a message using long-term credentials as described in RFC-5389 section-15.4:
+// MD5(username ":" realm ":" SASLprep(password)). The password is expected to
+// be already processed with SASLprep.
+func LongTermKey(username, realm, password string) []byte {
+	h := md5.Sum([]byte(username + ":" + realm + ":" + password))
+	return h[:]
+}
+
+// findAttr returns the offset of the first attribute of type t
+// in the encoded STUN message in data
+func findAttr(data []byte, t AttrType) (offset int, err error) {
+	if len(data) < 20 {
+		err = ErrMalformed
+		return
+	}
+
+	end := 20 + int(uint16(data[2])<<8|uint16(data[3]))
+	if end > len(data) {
+		err = ErrIncomplete
+		return
+	}
+
+	for offset = 20; offset+4 <= end; {
+		length := int(uint16(data[offset+2])<<8 | uint16(data[offset+3]))
+		if AttrType(uint16(data[offset])<<8|uint16(data[offset+1])) == t {
+			if offset+4+length > end {
+				err = ErrMalformed
+			}
+			return
+		}
+
+		// aligned at 32-bit boundary
+		offset += 4 + (length+3)&^3
+	}
+
+	err = ErrAttrNotFound
+	return
+}
+
+// integrity computes the HMAC over the message in data[:offset] as if the message
+// ended with an integrity attribute of the given value length at offset
+func integrity(h func() hash.Hash, data []byte, offset, length int, key []byte) []byte {
+	var header [4]byte
+	// length field includes the integrity attribute
+	lengthField := offset - 20 + 4 + length
+	header[0] = data[0]
+	header[1] = data[1]
+	header[2] = byte(lengthField >> 8)
+	header[3] = byte(lengthField)
+
+	mac := hmac.New(h, key)
+	mac.Write(header[:])
+	mac.Write(data[4:offset])
+
+	return mac.Sum(nil)
+}
+
+// appendIntegrity appends an integrity attribute to the encoded STUN message in data
+// and adjusts the header length accordingly
+func appendIntegrity(data []byte, t AttrType, value []byte) []byte {
+	data = marshalAttr(data, Attribute{Type: t, Value: value})
+
+	lengthField := uint16(len(data) - 20)
+	data[2] = byte(lengthField >> 8)
+	data[3] = byte(lengthField)
+
+	return data
+}
+
+// AddIntegrity appends a MESSAGE-INTEGRITY attribute to the encoded STUN message
+// in data computed with the given key, and adjusts the header length accordingly
+// as described in RFC-5389 section-15.4
+func AddIntegrity(data []byte, key []byte) []byte {
+	value := integrity(sha1.New, data, len(data), integrityLen, key)
+	return appendIntegrity(data, MessageIntegrity, value)
+}
+
+// findIntegrity returns the offset and value length of the integrity attribute of type t
+func findIntegrity(data []byte, t AttrType) (offset, length int, err error) {
+	if offset, err = findAttr(data, t); err != nil {
+		return
+	}
+
+	length = int(uint16(data[offset+2])<<8 | uint16(data[offset+3]))
+	return
+}
+
+// CheckIntegrity recomputes the MESSAGE-INTEGRITY of the encoded STUN message in data
+// with the given key and returns ErrIntegrity if it does not match. Attributes after
+// MESSAGE-INTEGRITY, except MESSAGE-INTEGRITY-SHA256 and FINGERPRINT, must be ignored
+// by the caller.
+func CheckIntegrity(data []byte, key []byte) (err error) {
+	var offset, length int
+	if offset, length, err = findIntegrity(data, MessageIntegrity); err != nil {
+		return
+	}
+
+	if length != integrityLen {
+		err = ErrMalformed
+		return
+	}
+
+	value := data[offset+4 : offset+4+length]
+	if !hmac.Equal(value, integrity(sha1.New, data, offset, length, key)) {
+		err = ErrIntegrity
+	}
+
+	return
+}
+
+// AddIntegritySHA256 appends a MESSAGE-INTEGRITY-SHA256 attribute to the encoded STUN
+// message in data computed with the given key and truncated to length bytes, and
+// adjusts the header length accordingly as described in RFC-8489 section-14.6.
+// The length must be a multiple of 4 between 16 and 32 or zero for no truncation.
+func AddIntegritySHA256(data []byte, key []byte, length int) ([]byte, error) {
+	if length == 0 {
+		length = integritySHA256Len
+	}
+
+	if !validIntegritySHA256Len(length) {
+		return data, ErrMalformed
+	}
+
+	value := integrity(sha256.New, data, len(data), length, key)[:length]
+	return appendIntegrity(data, MessageIntegritySHA256, value), nil
+}
+
+// CheckIntegritySHA256 recomputes the possibly truncated MESSAGE-INTEGRITY-SHA256
+// of the encoded STUN message in data with the given key and returns ErrIntegrity
+// if it does not match
+func CheckIntegritySHA256(data []byte, key []byte) (err error) {
+	var offset, length int
+	if offset, length, err = findIntegrity(data, MessageIntegritySHA256); err != nil {
+		return
+	}
+
+	if !validIntegritySHA256Len(length) {
+		err = ErrMalformed
+		return
+	}
+
+	value := data[offset+4 : offset+4+length]
+	if !hmac.Equal(value, integrity(sha256.New, data, offset, length, key)[:length]) {
+		err = ErrIntegrity
+	}
+
+	return
+}
+
+// validIntegritySHA256Len returns whether length is a valid truncation
+// of MESSAGE-INTEGRITY-SHA256 as described in RFC-8489 section-14.6
+func validIntegritySHA256Len(length int) bool {
+	return length >= 16 && length <= integritySHA256Len && length%4 == 0
+}
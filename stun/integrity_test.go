@@ -0,0 +1,103 @@
+package stun
+
+import (
+	"reflect"
+	"testing"
+)
+
+// credentials used to generate the RFC 5769 test vectors
+const (
+	rfc5769Password         = "VOkJxbRl1RmTxUk/WvJxBt"
+	rfc5769LongTermUsername = "マトリックス"
+	rfc5769LongTermRealm    = "example.org"
+	// SASLprep("The­MªtrⅨ")
+	rfc5769LongTermPassword = "TheMatrIX"
+)
+
+// rfc5769Padding returns a copy of data with attribute padding set to 0x20
+// as in the RFC 5769 section 2.1, 2.2 and 2.3 on-the-wire test vectors,
+// which is covered by the MESSAGE-INTEGRITY computation
+func rfc5769Padding(data []byte) []byte {
+	data = append([]byte(nil), data...)
+	for offset := 20; offset+4 <= len(data); {
+		length := int(uint16(data[offset+2])<<8 | uint16(data[offset+3]))
+		offset += 4 + length
+		for ; length%4 != 0; length++ {
+			data[offset] = 0x20
+			offset++
+		}
+	}
+	return data
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	shortTerm := ShortTermKey(rfc5769Password)
+	longTerm := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+
+	for _, tcase := range []struct {
+		data []byte
+		key  []byte
+	}{
+		{rfc5769Padding(rfc5769SampleRequestBytes), shortTerm},
+		{rfc5769Padding(rfc5769SampleResponseBytes), shortTerm},
+		{rfc5769Padding(rfc5769SampleResponseIPv6Bytes), shortTerm},
+		{rfc5769SampleRequestLongTermAuthBytes, longTerm},
+	} {
+		if err := CheckIntegrity(tcase.data, tcase.key); err != nil {
+			t.Errorf("expected integrity to be valid: %v", err)
+		}
+		if err := CheckIntegrity(tcase.data, []byte("bad password")); err != ErrIntegrity {
+			t.Errorf("expected ErrIntegrity but %v found", err)
+		}
+	}
+
+	if err := CheckIntegrity(rtcpPacket, shortTerm); err == nil {
+		t.Errorf("expected error on non STUN packet")
+	}
+}
+
+func TestAddIntegrity(t *testing.T) {
+	shortTerm := ShortTermKey(rfc5769Password)
+	longTerm := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+
+	for _, tcase := range []struct {
+		data []byte
+		key  []byte
+	}{
+		{rfc5769Padding(rfc5769SampleRequestBytes), shortTerm},
+		{rfc5769Padding(rfc5769SampleResponseBytes), shortTerm},
+		{rfc5769Padding(rfc5769SampleResponseIPv6Bytes), shortTerm},
+		{rfc5769SampleRequestLongTermAuthBytes, longTerm},
+	} {
+		offset, err := findAttr(tcase.data, MessageIntegrity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := tcase.data[offset : offset+4+integrityLen]
+
+		// strip MESSAGE-INTEGRITY and any attribute after it
+		data := AddIntegrity(append([]byte(nil), tcase.data[:offset]...), tcase.key)
+		if found := data[offset:]; !reflect.DeepEqual(expected, found) {
+			t.Errorf("expected %#v found %#v", expected, found)
+		}
+		if err := CheckIntegrity(data, tcase.key); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMarshalIntegrity(t *testing.T) {
+	key := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+	msg := rfc5769SampleRequestLongTermAuth
+	msg.Attr = msg.Attr[:len(msg.Attr)-1]
+
+	data, err := Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = AddIntegrity(data, key)
+	if !reflect.DeepEqual(rfc5769SampleRequestLongTermAuthBytes, data) {
+		t.Errorf("expected %#v found %#v", rfc5769SampleRequestLongTermAuthBytes, data)
+	}
+}
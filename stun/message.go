@@ -6,8 +6,14 @@ import (
 
 // Error as described in RFC-5389 section-18.3
 type Error struct {
-	code int
-	msg  string
+	// Code is the numeric error code value in the range of 300 to 699
+	Code int
+	// Reason is the UTF-8 encoded reason phrase
+	Reason string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Reason)
 }
 
 // AttrType as described in RFC-5389 section-18.2
@@ -86,6 +92,27 @@ var (
 	ErrIncomplete = fmt.Errorf("incomplete packet")
 )
 
+// encodeType returns the STUN message type field for the given method and class.
+// The 12 method bits are interleaved with the 2 class bits as described in
+// RFC-5389 section-6:
+//
+//	 0                 1
+//	 2  3  4 5 6 7 8 9 0 1 2 3 4 5
+//	+--+--+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|M |M |M|M|M|C|M|M|M|C|M|M|M|M|
+//	|11|10|9|8|7|1|6|5|4|0|3|2|1|0|
+//	+--+--+-+-+-+-+-+-+-+-+-+-+-+-+
+func encodeType(method Method, class Class) uint16 {
+	m := uint16(method)
+	return m&0x000f | (m&0x0070)<<1 | (m&0x0f80)<<2 | uint16(class)&stunTypeMask
+}
+
+// decodeType splits the STUN message type field into method and class
+func decodeType(tp uint16) (Method, Class) {
+	m := tp&0x000f | (tp>>1)&0x0070 | (tp>>2)&0x0f80
+	return Method(m), Class(tp & stunTypeMask)
+}
+
 func marshalAttr(data []byte, a Attribute) []byte {
 	var aheader [4]byte
 	var length int
@@ -111,9 +138,34 @@ func marshalAttr(data []byte, a Attribute) []byte {
 // Marshal encodes the given STUN message in binary using network-oriented format
 // as described in RFC-5389 section-6
 func Marshal(msg Message) (data []byte, err error) {
+	return msg.AppendTo(nil)
+}
+
+// size returns the length of the encoded message
+func (msg *Message) size() int {
+	n := 4 + len(msg.ID)
+	for _, a := range msg.Attr {
+		// aligned at 32-bit boundary
+		n += 4 + (len(a.Value)+3)&^3
+	}
+
+	return n
+}
+
+// AppendTo appends the binary encoding of the message to dst and returns the
+// extended buffer. It does not allocate if dst has enough spare capacity.
+func (msg *Message) AppendTo(dst []byte) (data []byte, err error) {
+	start := len(dst)
+
+	data = dst
+	if n := msg.size(); cap(data)-start < n {
+		data = make([]byte, start, start+n)
+		copy(data, dst)
+	}
+
 	// 4 bytes for type + length
 	var typeLen [4]byte
-	marshaledType := uint16(msg.Method) | uint16(msg.Class)
+	marshaledType := encodeType(msg.Method, msg.Class)
 	typeLen[0] = byte(marshaledType >> 8)
 	typeLen[1] = byte(marshaledType)
 
@@ -127,32 +179,43 @@ func Marshal(msg Message) (data []byte, err error) {
 	}
 
 	// excludes header length
-	lengthField := uint16(len(data) - 20)
-	data[2] = byte(lengthField >> 8)
-	data[3] = byte(lengthField)
+	lengthField := uint16(len(data) - start - 20)
+	data[start+2] = byte(lengthField >> 8)
+	data[start+3] = byte(lengthField)
 
 	return
 }
 
-func unmarshalAttr(data []byte) (attr Attribute, length int, err error) {
-	length = int(uint16(data[2])<<8 | uint16(data[3]))
+// unmarshalAttr decodes the attribute at the start of data and returns the number
+// of bytes it consumes including padding. The padding of the last attribute can
+// be missing unless strict is set.
+func unmarshalAttr(data []byte, strict bool) (attr Attribute, length int, err error) {
+	if len(data) < 4 {
+		err = ErrMalformed
+		return
+	}
+
 	attr.Type = AttrType(uint16(data[0])<<8 | uint16(data[1]))
+	length = int(uint16(data[2])<<8 | uint16(data[3]))
 
+	data = data[4:]
 	if len(data) < length {
 		err = ErrMalformed
 		return
 	}
 
-	data = data[4:]
-	widthPad := length
+	attr.Value = data[:length]
 
 	// aligned at 32-bit boundary
-	for widthPad%4 != 0 {
-		widthPad++
+	widthPad := (length + 3) &^ 3
+	if widthPad > len(data) {
+		if strict {
+			err = ErrMalformed
+			return
+		}
+		widthPad = len(data)
 	}
 
-	attr.Value = data[:length]
-
 	// consumed bytes
 	length = widthPad
 
@@ -160,48 +223,99 @@ func unmarshalAttr(data []byte) (attr Attribute, length int, err error) {
 }
 
 func unmarshal(data []byte) (msg Message, err error) {
+	err = msg.unmarshal(data, false)
+	return
+}
+
+// unmarshal decodes data into msg reusing the capacity of its attributes.
+// If strict is set, the header must satisfy all the constraints of
+// RFC-5389 section-6 and data must hold exactly one padded message.
+func (msg *Message) unmarshal(data []byte, strict bool) (err error) {
+	if len(data) < 20 {
+		err = ErrIncomplete
+		return
+	}
+
 	// length of the message excluding header
-	if len(data[20:]) < int(uint16(data[2])<<8|uint16(data[3])) {
+	length := int(uint16(data[2])<<8 | uint16(data[3]))
+	if len(data[20:]) < length {
 		err = ErrIncomplete
 		return
 	}
 
-	tp := uint16(data[0])<<8 | uint16(data[1])
+	if strict {
+		switch {
+		case data[0]>>6 != 0 || !isMagicCookie(data[4:8]):
+			err = ErrNoStun
+			return
+		case length%4 != 0 || len(data[20:]) != length:
+			err = ErrMalformed
+			return
+		}
+	}
 
 	// unknown method/class is delegated to handler
-	msg = Message{
-		Method: Method(tp & ^stunTypeMask),
-		Class:  Class(tp & stunTypeMask),
-		// magic cookie + transaction ID so we maintain backwards compatibility
-		ID: data[4:20],
-	}
+	msg.Method, msg.Class = decodeType(uint16(data[0])<<8 | uint16(data[1]))
+	// magic cookie + transaction ID so we maintain backwards compatibility
+	msg.ID = data[4:20]
+	msg.Attr = msg.Attr[:0]
 
-	data = data[20:]
+	data = data[20 : 20+length]
 
 	var attr Attribute
-	var length int
 	for len(data) >= 4 {
-		if attr, length, err = unmarshalAttr(data); err != nil {
+		if attr, length, err = unmarshalAttr(data, strict); err != nil {
 			return
 		}
 		msg.Attr = append(msg.Attr, attr)
 		data = data[4+length:]
 	}
 
+	if strict && len(data) != 0 {
+		err = ErrMalformed
+	}
+
 	return
 }
 
 // Unmarshal decodes the given packet into an RFC-5389 STUN message
-// or returns an error if there was a decoding error
+// or returns an error if there was a decoding error. If the message
+// has a FINGERPRINT attribute, it is validated with CheckFingerprint.
 func Unmarshal(data []byte) (msg Message, err error) {
 	if !IsStun(data) {
 		err = ErrNoStun
 		return
 	}
 
+	if err = CheckFingerprint(data); err != nil && err != ErrAttrNotFound {
+		return
+	}
+
 	return unmarshal(data)
 }
 
+// UnmarshalStrict decodes the given packet into an RFC-5389 STUN message
+// as Unmarshal does but rejects any deviation from RFC-5389 section-6: the top
+// two bits of the message type must be zero, the magic cookie must be present,
+// the length field must be a multiple of 4 and match the length of the packet,
+// and every attribute must be padded to a 32-bit boundary. It never panics
+// regardless of the input, so it should be used on untrusted packets.
+func UnmarshalStrict(data []byte) (msg Message, err error) {
+	if err = msg.unmarshal(data, true); err != nil {
+		return
+	}
+
+	switch err = CheckFingerprint(data); err {
+	case nil:
+	case ErrAttrNotFound:
+		err = nil
+	default:
+		msg = Message{}
+	}
+
+	return
+}
+
 // UnmarshalCompat decodes a a given packet into a structured STUN message,
 // as described in RFC-5389 maintaining bacwkards compatibility with RFC-3489.
 // Unmarshal should be prefered except for maintaing backwards compatibility.
@@ -213,3 +327,27 @@ func UnmarshalCompat(data []byte) (msg Message, err error) {
 
 	return unmarshal(data)
 }
+
+// Decode decodes the given packet into msg as Unmarshal does, falling back to
+// UnmarshalCompat if it has no magic cookie. The capacity of msg.Attr is reused
+// so decoding does not allocate once it is large enough. The ID and attribute
+// values of msg reference data.
+func (msg *Message) Decode(data []byte) (err error) {
+	if IsStun(data) {
+		if err = CheckFingerprint(data); err != nil && err != ErrAttrNotFound {
+			return
+		}
+	} else if !IsStunCompat(data) {
+		err = ErrNoStun
+		return
+	}
+
+	return msg.unmarshal(data, false)
+}
+
+// decode decodes the given packet into an RFC-5389 STUN message
+// falling back to RFC-3489 if it has no magic cookie
+func decode(data []byte) (msg Message, err error) {
+	err = msg.Decode(data)
+	return
+}
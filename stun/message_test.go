@@ -456,11 +456,11 @@ func TestUnmarshal(t *testing.T) {
 		if !reflect.DeepEqual(tcase.msg, msg) {
 			t.Errorf("expected:\n")
 			e, _ := json.MarshalIndent(tcase.msg, "", "  ")
-			t.Errorf(string(e))
+			t.Error(string(e))
 
 			t.Errorf("found:\n")
 			f, _ := json.MarshalIndent(msg, "", "  ")
-			t.Errorf(string(f))
+			t.Error(string(f))
 		}
 	}
 }
@@ -475,9 +475,9 @@ func TestMarshal(t *testing.T) {
 		if !reflect.DeepEqual(tcase.data, data) {
 			t.Errorf("expected vs found:\n")
 			e, _ := json.MarshalIndent(tcase.data, "", "  ")
-			t.Errorf(string(e))
+			t.Error(string(e))
 			f, _ := json.MarshalIndent(data, "", "  ")
-			t.Errorf(string(f))
+			t.Error(string(f))
 			t.Errorf("expected vs found bytes:\n")
 			t.Errorf("%#v", tcase.data)
 			t.Errorf("%#v", data)
@@ -508,3 +508,384 @@ func TestIsLegacy(t *testing.T) {
 		t.Fatalf("message should NOT me marked as legacy")
 	}
 }
+
+func TestMessageType(t *testing.T) {
+	for _, tcase := range []struct {
+		method Method
+		class  Class
+		tp     uint16
+	}{
+		{Binding, Request, 0x0001},
+		{Binding, Indication, 0x0011},
+		{Binding, SuccessResponse, 0x0101},
+		{Binding, ErrorResponse, 0x0111},
+		{Allocate, Request, 0x0003},
+		{Allocate, SuccessResponse, 0x0103},
+		{Allocate, ErrorResponse, 0x0113},
+		{Refresh, Request, 0x0004},
+		{Refresh, SuccessResponse, 0x0104},
+		{Send, Indication, 0x0016},
+		{Data, Indication, 0x0017},
+		{CreatePermission, Request, 0x0008},
+		{CreatePermission, SuccessResponse, 0x0108},
+		{ChannelBind, Request, 0x0009},
+		{ChannelBind, ErrorResponse, 0x0119},
+		{Method(0x010), Request, 0x0020},
+		{Method(0x080), Request, 0x0200},
+		{Method(0xfff), Request, 0x3eef},
+		{Method(0xfff), ErrorResponse, 0x3fff},
+	} {
+		if tp := encodeType(tcase.method, tcase.class); tp != tcase.tp {
+			t.Errorf("expected method %#3x class %#3x to be encoded as %#04x but %#04x found",
+				tcase.method, tcase.class, tcase.tp, tp)
+		}
+
+		method, class := decodeType(tcase.tp)
+		if method != tcase.method || class != tcase.class {
+			t.Errorf("expected %#04x to be decoded as method %#3x class %#3x but %#3x %#3x found",
+				tcase.tp, tcase.method, tcase.class, method, class)
+		}
+	}
+}
+
+func TestMessageTypeRoundTrip(t *testing.T) {
+	for m := 0; m <= 0xfff; m++ {
+		for _, class := range []Class{Request, Indication, SuccessResponse, ErrorResponse} {
+			msg := Message{Method: Method(m), Class: class, ID: rfc5769SampleRequest.ID}
+
+			data, err := Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data[0]>>6 != 0 {
+				t.Fatalf("expected two most significant bits to be zero for %#3x", m)
+			}
+
+			found, err := Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkType(t, &found, msg.Method, msg.Class)
+		}
+	}
+}
+
+// rfc5769Samples are the RFC 5769 messages as received on the wire
+var rfc5769Samples = []testCase{
+	{rfc5769Padding(rfc5769SampleRequestBytes), rfc5769SampleRequest},
+	{rfc5769Padding(rfc5769SampleResponseBytes), rfc5769SampleResponse},
+	{rfc5769Padding(rfc5769SampleResponseIPv6Bytes), rfc5769SampleResponseIPv6},
+	{rfc5769SampleRequestLongTermAuthBytes, rfc5769SampleRequestLongTermAuth},
+}
+
+func TestMessageDecode(t *testing.T) {
+	var msg Message
+	for _, tcase := range append(rfc5769Samples, testCase{rfc3489SampleRequestBytes, rfc3489SampleRequest}) {
+		if err := msg.Decode(tcase.data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tcase.msg, msg) {
+			t.Errorf("expected %#v found %#v", tcase.msg, msg)
+		}
+	}
+
+	if err := msg.Decode(rtcpPacket); err != ErrNoStun {
+		t.Errorf("expected ErrNoStun but %v found", err)
+	}
+}
+
+func TestMessageAppendTo(t *testing.T) {
+	prefix := []byte{0xde, 0xad}
+	for _, tcase := range marshalTestcases {
+		data, err := tcase.msg.AppendTo(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(prefix, data[:len(prefix)]) {
+			t.Errorf("expected prefix %#v found %#v", prefix, data[:len(prefix)])
+		}
+		if !reflect.DeepEqual(tcase.data, data[len(prefix):]) {
+			t.Errorf("expected %#v found %#v", tcase.data, data[len(prefix):])
+		}
+	}
+}
+
+func TestMessageDecodeAllocs(t *testing.T) {
+	for _, tcase := range rfc5769Samples {
+		var msg Message
+		allocs := testing.AllocsPerRun(100, func() {
+			msg.Decode(tcase.data)
+		})
+		if allocs != 0 {
+			t.Errorf("expected no allocations but %v found", allocs)
+		}
+	}
+}
+
+func TestMessageAppendToAllocs(t *testing.T) {
+	buf := make([]byte, 0, maxpacket)
+	for _, tcase := range rfc5769Samples {
+		msg := tcase.msg
+		allocs := testing.AllocsPerRun(100, func() {
+			msg.AppendTo(buf[:0])
+		})
+		if allocs != 0 {
+			t.Errorf("expected no allocations but %v found", allocs)
+		}
+	}
+}
+
+func BenchmarkMessageDecode(b *testing.B) {
+	data := rfc5769SampleRequestLongTermAuthBytes
+	var msg Message
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if err := msg.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessageAppendTo(b *testing.B) {
+	msg := rfc5769SampleRequestLongTermAuth
+	buf := make([]byte, 0, maxpacket)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(rfc5769SampleRequestLongTermAuthBytes)))
+	for i := 0; i < b.N; i++ {
+		if _, err := msg.AppendTo(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := rfc5769SampleRequestLongTermAuthBytes
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Unmarshal(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	msg := rfc5769SampleRequestLongTermAuth
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(rfc5769SampleRequestLongTermAuthBytes)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// malformedTestcases are packets rejected by UnmarshalStrict
+var malformedTestcases = []struct {
+	name string
+	data []byte
+	err  error
+}{
+	{"empty", nil, ErrIncomplete},
+	{"short header", rfc5769SampleRequestBytes[:19], ErrIncomplete},
+	{"truncated", rfc5769SampleRequestBytes[:40], ErrIncomplete},
+	{"legacy", rfc3489SampleRequestBytes, ErrNoStun},
+	{"rtcp", rtcpPacket, ErrNoStun},
+	{"top bits", withBytes(rfc5769SampleRequestBytes, 0, 0x40), ErrNoStun},
+	{"unaligned length", withBytes(rfc5769SampleRequestBytes[:len(rfc5769SampleRequestBytes)-1], 3, rfc5769SampleRequestBytes[3]-1), ErrMalformed},
+	{"trailing data", append(append([]byte(nil), rfc5769SampleRequestBytes...), 0, 0, 0, 0), ErrMalformed},
+	// SOFTWARE length overruns the message
+	{"attribute overrun", withBytes(rfc5769SampleRequestBytes, 23, 0xff), ErrMalformed},
+	{"unpadded", rfc5769Unpadded, ErrMalformed},
+	{"fingerprint", withBytes(rfc5769Padding(rfc5769SampleRequestBytes), 27, 0), ErrFingerprint},
+}
+
+// rfc5769Unpadded is a message with a single SOFTWARE attribute of
+// one byte missing its padding
+var rfc5769Unpadded = withBytes(rfc5769SampleRequestBytes[:25], 2, 0, 3, 5, 22, 0, 23, 1)
+
+// withBytes returns a copy of data with the given offset/value pairs replaced
+func withBytes(data []byte, pairs ...byte) []byte {
+	data = append([]byte(nil), data...)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		data[pairs[i]] = pairs[i+1]
+	}
+	return data
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	for _, tcase := range rfc5769Samples {
+		msg, err := UnmarshalStrict(tcase.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tcase.msg, msg) {
+			t.Errorf("expected %#v found %#v", tcase.msg, msg)
+		}
+	}
+
+	for _, tcase := range malformedTestcases {
+		if _, err := UnmarshalStrict(tcase.data); err != tcase.err {
+			t.Errorf("%s: expected %v but %v found", tcase.name, tcase.err, err)
+		}
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, tcase := range malformedTestcases {
+		// must not panic
+		UnmarshalCompat(tcase.data)
+		Unmarshal(tcase.data)
+	}
+
+	// the padding of the last attribute is not required
+	msg, err := Unmarshal(rfc5769Unpadded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Attr) != 1 || len(msg.Attr[0].Value) != 1 {
+		t.Errorf("expected a single attribute of one byte found %#v", msg.Attr)
+	}
+}
+
+func FuzzUnmarshalStrict(f *testing.F) {
+	for _, tcase := range marshalTestcases {
+		f.Add(tcase.data)
+	}
+	for _, tcase := range rfc5769Samples {
+		f.Add(tcase.data)
+	}
+	for _, tcase := range malformedTestcases {
+		f.Add(tcase.data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := UnmarshalStrict(data)
+		if err != nil {
+			return
+		}
+
+		// a strictly decoded message re-encodes to the same length and decodes
+		// to the same message, only padding bytes can differ
+		encoded, err := Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encoded) != len(data) {
+			t.Fatalf("expected length %d found %d", len(data), len(encoded))
+		}
+
+		found, err := UnmarshalStrict(encoded)
+		if err != nil && err != ErrFingerprint {
+			t.Fatal(err)
+		}
+		if err == nil && !reflect.DeepEqual(msg, found) {
+			t.Errorf("expected %#v found %#v", msg, found)
+		}
+	})
+}
+
+// isCanonical returns whether data holds exactly one message whose length field
+// is a multiple of 4 and whose attributes are padded with zeros, so that
+// Marshal reproduces it from its decoded message
+func isCanonical(data []byte) bool {
+	if len(data) < 20 || len(data) != 20+int(uint16(data[2])<<8|uint16(data[3])) {
+		return false
+	}
+
+	for data = data[20:]; len(data) > 0; {
+		if len(data) < 4 {
+			return false
+		}
+
+		length := int(uint16(data[2])<<8 | uint16(data[3]))
+		padded := 4 + (length+3)&^3
+		if padded > len(data) {
+			return false
+		}
+
+		for _, b := range data[4+length : padded] {
+			if b != 0 {
+				return false
+			}
+		}
+
+		data = data[padded:]
+	}
+
+	return true
+}
+
+// addSeedCorpus adds the byte vectors of the test cases to the seed corpus
+func addSeedCorpus(f *testing.F) {
+	for _, tcase := range marshalTestcases {
+		f.Add(tcase.data)
+	}
+	for _, tcase := range rfc5769Samples {
+		f.Add(tcase.data)
+	}
+	f.Add(rtcpPacket)
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	addSeedCorpus(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if msg, err := Unmarshal(data); err == nil && !IsStun(data) {
+			t.Errorf("expected error on non STUN packet found %#v", msg)
+		}
+
+		msg, err := UnmarshalCompat(data)
+		if err != nil {
+			return
+		}
+
+		if len(msg.ID) != 16 {
+			t.Errorf("expected transaction ID of 16 bytes found %d", len(msg.ID))
+		}
+
+		length := 0
+		for _, a := range msg.Attr {
+			length += 4 + len(a.Value)
+		}
+		if 20+length > len(data) {
+			t.Errorf("attributes of %d bytes exceed packet of %d bytes", length, len(data))
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	addSeedCorpus(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := UnmarshalCompat(data)
+		if err != nil {
+			return
+		}
+
+		encoded, err := Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isCanonical(data) && !reflect.DeepEqual(data, encoded) {
+			t.Fatalf("expected %#v found %#v", data, encoded)
+		}
+
+		// the encoding of any decoded message is canonical
+		found, err := UnmarshalCompat(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isCanonical(encoded) || !reflect.DeepEqual(msg, found) {
+			t.Errorf("expected %#v found %#v", msg, found)
+		}
+	})
+}
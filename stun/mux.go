@@ -0,0 +1,211 @@
+package stun
+
+import (
+	"net"
+	"sync"
+)
+
+// ResponseWriter is used by a Handler to send responses to the client
+type ResponseWriter interface {
+	// WriteMessage marshals and sends msg to the client
+	WriteMessage(msg Message) error
+}
+
+// Incoming is a STUN message received by a Server. The transaction ID,
+// the attribute values and Raw point into a buffer the Server reuses
+// for the next packet, so the whole Incoming is only valid until the
+// handler returns and must be copied by handlers that keep any part of it.
+type Incoming struct {
+	Message
+	// Raw is the message as received on the wire
+	Raw []byte
+	// RemoteAddr is the address the message was received from
+	RemoteAddr net.Addr
+	// LocalAddr is the address the message was received on
+	LocalAddr net.Addr
+	// Key, if set, is used to add MESSAGE-INTEGRITY to the responses.
+	// It is set by LongTermAuth after authenticating the message.
+	Key []byte
+	// IntegritySHA256 indicates that MESSAGE-INTEGRITY-SHA256 is added to
+	// the responses instead of MESSAGE-INTEGRITY
+	IntegritySHA256 bool
+
+	// known comprehension-required attributes and whether they were checked
+	known   AttrSet
+	checked bool
+}
+
+// Handler responds to a STUN message received by a Server
+type Handler interface {
+	ServeSTUN(w ResponseWriter, in *Incoming)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as handlers
+type HandlerFunc func(w ResponseWriter, in *Incoming)
+
+// ServeSTUN calls f(w, in)
+func (f HandlerFunc) ServeSTUN(w ResponseWriter, in *Incoming) {
+	f(w, in)
+}
+
+// BadRequest replies to requests with a 400 error response and ignores
+// any other class of message
+func BadRequest(w ResponseWriter, in *Incoming) {
+	if in.Class == Request {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+	}
+}
+
+// BadRequestHandler returns a handler that calls BadRequest
+func BadRequestHandler() Handler {
+	return HandlerFunc(BadRequest)
+}
+
+// BindingHandler returns a handler that calls ServeBinding
+func BindingHandler() Handler {
+	return HandlerFunc(ServeBinding)
+}
+
+// ServeBinding replies to Binding requests with the address they
+// were received from as described in RFC-5389 section-10.1.2.
+// RFC-3489 requests are also answered with the SOURCE-ADDRESS of the server,
+// unless it listens on an unspecified or IPv6 address, and, when served with ServeAlternate, the response honours CHANGE-REQUEST
+// and RESPONSE-ADDRESS as described in RFC-3489 section-8.1, and RFC-5389
+// requests are answered as described in RFC-5780 section-6.1.
+func ServeBinding(w ResponseWriter, in *Incoming) {
+	addr, ok := transportAddr(in.RemoteAddr)
+	if !ok {
+		w.WriteMessage(in.ErrorResponse(ErrBadRequest))
+		return
+	}
+
+	resp, err := bindingResponse(&in.Message, addr)
+	if err != nil {
+		w.WriteMessage(in.ErrorResponse(ErrServerError))
+		return
+	}
+
+	aw, isAlternate := w.(AlternateResponseWriter)
+	switch {
+	case isAlternate && in.IsLegacy():
+		serveClassicBinding(aw, in, resp)
+		return
+	case isAlternate:
+		serveDiscoveryBinding(aw, in, resp)
+		return
+	case !in.IsLegacy():
+		w.WriteMessage(resp)
+		return
+	}
+
+	if source, ok := classicAddr(in.LocalAddr); ok {
+		resp.SetSourceAddress(source)
+	}
+
+	w.WriteMessage(resp)
+}
+
+// Redirect replies to requests with a 300 error response and an ALTERNATE-SERVER
+// attribute with the given address as described in RFC-5389 section-11, so that
+// clients retry their request with the alternate server. Any other class of
+// message is ignored.
+func Redirect(w ResponseWriter, in *Incoming, addr *net.UDPAddr) {
+	if in.Class != Request {
+		return
+	}
+
+	resp := in.ErrorResponse(ErrTryAlternateServer)
+	if err := resp.SetAlternateServer(addr); err != nil {
+		resp = in.ErrorResponse(ErrServerError)
+	}
+
+	w.WriteMessage(resp)
+}
+
+// RedirectHandler returns a handler that redirects every request it receives
+// to the given address with Redirect. If the requests are authenticated, it
+// should be wrapped with LongTermAuth so the redirection is protected with
+// the credentials of the request.
+func RedirectHandler(addr *net.UDPAddr) Handler {
+	return HandlerFunc(func(w ResponseWriter, in *Incoming) {
+		Redirect(w, in, addr)
+	})
+}
+
+type muxKey struct {
+	method Method
+	class  Class
+}
+
+// ServeMux is a STUN message multiplexer. It dispatches each received
+// message to the handler registered for its method and class, or to
+// BadRequest if there is none.
+type ServeMux struct {
+	mu       sync.RWMutex
+	handlers map[muxKey]Handler
+}
+
+// NewServeMux allocates and returns a new ServeMux
+func NewServeMux() *ServeMux {
+	return &ServeMux{handlers: make(map[muxKey]Handler)}
+}
+
+// DefaultServeMux is the default ServeMux used by Server.
+// It answers Binding requests with ServeBinding.
+var DefaultServeMux = newDefaultServeMux()
+
+func newDefaultServeMux() *ServeMux {
+	mux := NewServeMux()
+	mux.Handle(Binding, Request, BindingHandler())
+	return mux
+}
+
+// Handle registers the handler for messages of the given method and class,
+// replacing any previously registered handler
+func (mux *ServeMux) Handle(method Method, class Class, handler Handler) {
+	mux.mu.Lock()
+	mux.handlers[muxKey{method, class}] = handler
+	mux.mu.Unlock()
+}
+
+// HandleFunc registers the handler function for messages of the given method and class
+func (mux *ServeMux) HandleFunc(method Method, class Class, handler func(ResponseWriter, *Incoming)) {
+	mux.Handle(method, class, HandlerFunc(handler))
+}
+
+// Handler returns the handler registered for messages of the given method and class
+// or BadRequestHandler if there is none
+func (mux *ServeMux) Handler(method Method, class Class) Handler {
+	mux.mu.RLock()
+	h, ok := mux.handlers[muxKey{method, class}]
+	mux.mu.RUnlock()
+
+	if !ok {
+		return BadRequestHandler()
+	}
+
+	return h
+}
+
+// ServeSTUN dispatches the message to the handler registered for its method and class
+// once its comprehension-required attributes are checked, unless the handler is
+// LongTermAuth which checks them after authenticating the message
+func (mux *ServeMux) ServeSTUN(w ResponseWriter, in *Incoming) {
+	h := mux.Handler(in.Method, in.Class)
+	if !checksUnknown(h) && !checkUnknown(w, in) {
+		return
+	}
+
+	h.ServeSTUN(w, in)
+}
+
+// Handle registers the handler for messages of the given method and class in DefaultServeMux
+func Handle(method Method, class Class, handler Handler) {
+	DefaultServeMux.Handle(method, class, handler)
+}
+
+// HandleFunc registers the handler function for messages of the given method and class
+// in DefaultServeMux
+func HandleFunc(method Method, class Class, handler func(ResponseWriter, *Incoming)) {
+	DefaultServeMux.HandleFunc(method, class, handler)
+}
@@ -0,0 +1,70 @@
+package stun
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testMethod is an unassigned method used to test custom handlers
+const testMethod Method = 0x00e
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle(Binding, Request, BindingHandler())
+
+	indications := make(chan *Incoming, 1)
+	mux.HandleFunc(testMethod, Request, func(w ResponseWriter, in *Incoming) {
+		resp := in.Response()
+		resp.Set(Software, []byte("custom"))
+		w.WriteMessage(resp)
+	})
+	mux.HandleFunc(testMethod, Indication, func(w ResponseWriter, in *Incoming) {
+		indications <- in
+	})
+
+	conn, pc := serveTestServer(t, &Server{Handler: mux})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := conn.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	resp, err = conn.Do(ctx, Message{Class: Request, Method: testMethod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, testMethod, SuccessResponse)
+	if software, _ := resp.Get(Software); string(software) != "custom" {
+		t.Errorf("expected SOFTWARE to be %q but %q found", "custom", software)
+	}
+
+	// no handler registered for this method
+	resp, err = conn.Do(ctx, Message{Class: Request, Method: testMethod + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, testMethod+1, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrBadRequest {
+		t.Errorf("expected %v found %v", ErrBadRequest, e)
+	}
+
+	if err := conn.WriteMessage(Message{Class: Indication, Method: testMethod, ID: rfc5769SampleRequest.ID}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case in := <-indications:
+		checkType(t, &in.Message, testMethod, Indication)
+		if in.RemoteAddr.String() != conn.LocalAddr().String() {
+			t.Errorf("expected remote address %s found %s", conn.LocalAddr(), in.RemoteAddr)
+		}
+	case <-ctx.Done():
+		t.Fatal("indication was not dispatched")
+	}
+}
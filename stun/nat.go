@@ -0,0 +1,455 @@
+package stun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultLifetimeResolution is the precision of the binding lifetime discovery
+	DefaultLifetimeResolution = time.Second
+	// DefaultKeepAliveInterval is the keepalive interval recommended when the
+	// binding lifetime is unknown as described in RFC-8445 section-11
+	DefaultKeepAliveInterval = 15 * time.Second
+)
+
+// ErrNoDiscovery is returned when a server does not support
+// NAT behavior discovery as described in RFC-5780 section-4.2
+var ErrNoDiscovery = fmt.Errorf("server does not support NAT behavior discovery")
+
+// Behavior is the mapping or filtering behavior of a NAT
+// as described in RFC-4787 section-4.1 and section-5
+type Behavior int
+
+const (
+	BehaviorUnknown Behavior = iota
+	EndpointIndependent
+	AddressDependent
+	AddressAndPortDependent
+)
+
+func (b Behavior) String() string {
+	switch b {
+	case EndpointIndependent:
+		return "endpoint-independent"
+	case AddressDependent:
+		return "address-dependent"
+	case AddressAndPortDependent:
+		return "address-and-port-dependent"
+	default:
+		return "unknown"
+	}
+}
+
+// NATBehavior is the result of the NAT behavior discovery tests
+type NATBehavior struct {
+	// MappedAddress is the address of the client as seen by the server
+	MappedAddress *net.UDPAddr
+	// NAT is whether the mapped address differs from the local address
+	NAT bool
+	// Mapping is how the NAT reuses mappings for different destinations
+	Mapping Behavior
+	// Filtering is which sources the NAT lets reach a mapping
+	Filtering Behavior
+	// Hairpinning is whether the NAT routes packets sent to
+	// its own mapped addresses back to the client
+	Hairpinning bool
+	// BindingLifetime is a lower bound of the time the NAT keeps an idle
+	// mapping, zero if it was not measured
+	BindingLifetime time.Duration
+}
+
+// KeepAliveInterval returns the recommended interval between keepalives to keep
+// a mapping of the NAT alive, which is half of the binding lifetime so a lost
+// keepalive can be tolerated, or DefaultKeepAliveInterval if the lifetime is
+// unknown. It returns zero if there is no NAT.
+func (b NATBehavior) KeepAliveInterval() time.Duration {
+	switch {
+	case !b.NAT:
+		return 0
+	case b.BindingLifetime <= 0:
+		return DefaultKeepAliveInterval
+	default:
+		return b.BindingLifetime / 2
+	}
+}
+
+// NATDiscovery runs the NAT behavior discovery tests of RFC-5780 section-4
+// against a server with alternate addresses, such as one served with
+// Server.ServeAlternate.
+//
+// Some tests expect no response, so each of them takes as long as a
+// transaction timeout, which is 39.5 seconds with the default retransmission
+// parameters of RFC-5389 section-7.2.1.
+type NATDiscovery struct {
+	// Server is the primary address of the server
+	Server string
+	// ListenPacket opens the UDP sockets used by the tests. If nil, sockets
+	// are opened on all the local addresses with a port chosen by the system.
+	ListenPacket func() (net.PacketConn, error)
+	// RTO, Rc and Rm are the retransmission parameters of each test.
+	// If zero, DefaultRTO, DefaultRc and DefaultRm are used.
+	RTO time.Duration
+	Rc  int
+	Rm  int
+	// MaxLifetime is the longest binding lifetime probed. If zero,
+	// the binding lifetime is not measured. See Discover for its cost.
+	MaxLifetime time.Duration
+	// LifetimeResolution is the precision of the binding lifetime discovery.
+	// If zero, DefaultLifetimeResolution is used.
+	LifetimeResolution time.Duration
+}
+
+func (d *NATDiscovery) listen() (net.PacketConn, error) {
+	if d.ListenPacket != nil {
+		return d.ListenPacket()
+	}
+	return net.ListenPacket("udp", ":0")
+}
+
+// transact sends req to addr from send retransmitting it as a Client does and returns
+// the first message with the same transaction ID received on recv from any address,
+// or ErrTimeout if there is none
+func (d *NATDiscovery) transact(ctx context.Context, send, recv net.PacketConn, req Message, addr net.Addr) (resp Message, from net.Addr, err error) {
+	if req.ID == nil {
+		if req.ID, err = NewTransactionID(); err != nil {
+			return
+		}
+	}
+
+	var data []byte
+	if data, err = Marshal(req); err != nil {
+		return
+	}
+
+	// cancellation interrupts the read in progress
+	stop := context.AfterFunc(ctx, func() {
+		recv.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	defer recv.SetReadDeadline(time.Time{})
+
+	rto, rc, rm := retransmission(d.RTO, d.Rc, d.Rm)
+	wait := rto
+	buf := make([]byte, maxpacket)
+
+	for i := 0; i < rc; i++ {
+		if _, err = send.WriteTo(data, addr); err != nil {
+			return
+		}
+
+		if i == rc-1 {
+			wait = rto * time.Duration(rm)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		recv.SetReadDeadline(time.Now().Add(wait))
+
+		for {
+			var n int
+			if n, from, err = recv.ReadFrom(buf); err != nil {
+				break
+			}
+
+			if resp, err = UnmarshalCompat(buf[:n]); err == nil && string(resp.ID) == string(req.ID) {
+				return
+			}
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+			return
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+
+		wait *= 2
+	}
+
+	err = ErrTimeout
+	return
+}
+
+// binding performs a Binding transaction with addr over pc
+// and returns the response, or false if it timed out
+func (d *NATDiscovery) binding(ctx context.Context, pc net.PacketConn, addr net.Addr, setters ...Setter) (resp Message, ok bool, err error) {
+	var req Message
+	if req, err = NewMessage(Binding, Request, setters...); err != nil {
+		return
+	}
+
+	resp, _, err = d.transact(ctx, pc, pc, req, addr)
+	switch {
+	case err == ErrTimeout:
+		return resp, false, nil
+	case err != nil:
+		return
+	case resp.Class != SuccessResponse:
+		e, _ := resp.ErrorCode()
+		err = e
+		return
+	}
+
+	return resp, true, nil
+}
+
+// changeRequest is a Setter of the CHANGE-REQUEST attribute
+type changeRequest struct {
+	changeIP, changePort bool
+}
+
+func (c changeRequest) AddTo(msg *Message) error {
+	msg.SetChangeRequest(c.changeIP, c.changePort)
+	return nil
+}
+
+// Discover runs the mapping, filtering and hairpinning tests of RFC-5780
+// section-4.3, section-4.4 and section-4.5, and measures the binding
+// lifetime if MaxLifetime is set.
+//
+// The lifetime is found with a binary search whose probes wait up to MaxLifetime
+// each, so it takes roughly MaxLifetime * log2(MaxLifetime/LifetimeResolution),
+// plus a transaction timeout for each expired binding: with a MaxLifetime of 800ms
+// and a resolution of 50ms, a long-lived binding is probed after 400, 600, 700 and
+// 750ms, about 2.5s in total, while 5 minutes at 1s takes over half an hour.
+// A lost probe response is taken as an expired binding, so packet loss can
+// make the measured lifetime shorter than the actual one.
+func (d *NATDiscovery) Discover(ctx context.Context) (result NATBehavior, err error) {
+	var server *net.UDPAddr
+	if server, err = net.ResolveUDPAddr("udp", d.Server); err != nil {
+		return
+	}
+
+	var pc net.PacketConn
+	if pc, err = d.listen(); err != nil {
+		return
+	}
+	defer pc.Close()
+
+	// test I
+	resp, ok, err := d.binding(ctx, pc, server)
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = ErrTimeout
+		return
+	}
+
+	var other *net.UDPAddr
+	if result.MappedAddress, err = resp.XORMappedAddress(); err != nil {
+		return
+	}
+	if other, err = resp.OtherAddress(); err != nil {
+		err = ErrNoDiscovery
+		return
+	}
+
+	result.NAT = !isLocalAddr(result.MappedAddress, pc.LocalAddr())
+
+	// filtering is tested before the mapping tests send
+	// packets to the alternate addresses of the server
+	if result.Filtering, err = d.filtering(ctx, pc, server); err != nil {
+		return
+	}
+
+	if result.Mapping, err = d.mapping(ctx, pc, server, other, result.MappedAddress); err != nil {
+		return
+	}
+
+	if result.Hairpinning, err = d.hairpinning(ctx, pc, result.MappedAddress); err != nil {
+		return
+	}
+
+	if d.MaxLifetime > 0 {
+		result.BindingLifetime, err = d.lifetime(ctx, server)
+	}
+
+	return
+}
+
+// mapping runs the mapping behavior tests of RFC-5780 section-4.3
+func (d *NATDiscovery) mapping(ctx context.Context, pc net.PacketConn, server, other, mapped *net.UDPAddr) (b Behavior, err error) {
+	// test II to the alternate IP address and primary port
+	resp, ok, err := d.binding(ctx, pc, &net.UDPAddr{IP: other.IP, Port: server.Port})
+	if err != nil || !ok {
+		return
+	}
+
+	var mapped2, mapped3 *net.UDPAddr
+	if mapped2, err = resp.XORMappedAddress(); err != nil {
+		return
+	}
+	if mapped2.String() == mapped.String() {
+		return EndpointIndependent, nil
+	}
+
+	// test III to the alternate IP address and port
+	if resp, ok, err = d.binding(ctx, pc, other); err != nil || !ok {
+		return
+	}
+	if mapped3, err = resp.XORMappedAddress(); err != nil {
+		return
+	}
+	if mapped3.String() == mapped2.String() {
+		return AddressDependent, nil
+	}
+
+	return AddressAndPortDependent, nil
+}
+
+// filtering runs the filtering behavior tests of RFC-5780 section-4.4
+func (d *NATDiscovery) filtering(ctx context.Context, pc net.PacketConn, server *net.UDPAddr) (b Behavior, err error) {
+	// test II from the alternate IP address and port
+	_, ok, err := d.binding(ctx, pc, server, changeRequest{changeIP: true, changePort: true})
+	switch {
+	case err != nil:
+		return
+	case ok:
+		return EndpointIndependent, nil
+	}
+
+	// test III from the alternate port
+	_, ok, err = d.binding(ctx, pc, server, changeRequest{changePort: true})
+	switch {
+	case err != nil:
+		return
+	case ok:
+		return AddressDependent, nil
+	}
+
+	return AddressAndPortDependent, nil
+}
+
+// hairpinning sends a Binding request to the mapped address of pc from
+// another socket as described in RFC-5780 section-4.5 and returns whether
+// it is received on pc
+func (d *NATDiscovery) hairpinning(ctx context.Context, pc net.PacketConn, mapped *net.UDPAddr) (ok bool, err error) {
+	var other net.PacketConn
+	if other, err = d.listen(); err != nil {
+		return
+	}
+	defer other.Close()
+
+	var req Message
+	if req, err = NewMessage(Binding, Request); err != nil {
+		return
+	}
+
+	if _, _, err = d.transact(ctx, other, pc, req, mapped); err == ErrTimeout {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// lifetime finds the binding lifetime with a binary search over the idle time of
+// the probes between zero and MaxLifetime as described in RFC-5780 section-4.6.
+// It returns the longest idle time after which the binding was still alive,
+// which is within LifetimeResolution of the lifetime.
+func (d *NATDiscovery) lifetime(ctx context.Context, server *net.UDPAddr) (lifetime time.Duration, err error) {
+	resolution := d.LifetimeResolution
+	if resolution <= 0 {
+		resolution = DefaultLifetimeResolution
+	}
+
+	for dead := d.MaxLifetime; dead-lifetime > resolution; {
+		idle := lifetime + (dead-lifetime)/2
+
+		var alive bool
+		if alive, err = d.probeLifetime(ctx, server, idle); err != nil {
+			return
+		}
+
+		if alive {
+			lifetime = idle
+		} else {
+			dead = idle
+		}
+	}
+
+	return
+}
+
+// probeLifetime creates a binding, waits idle for the given time and returns
+// whether a response sent to it with RESPONSE-PORT from another socket is received
+func (d *NATDiscovery) probeLifetime(ctx context.Context, server *net.UDPAddr, idle time.Duration) (alive bool, err error) {
+	var x, y net.PacketConn
+	if x, err = d.listen(); err != nil {
+		return
+	}
+	defer x.Close()
+
+	if y, err = d.listen(); err != nil {
+		return
+	}
+	defer y.Close()
+
+	resp, ok, err := d.binding(ctx, x, server)
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = ErrTimeout
+		return
+	}
+
+	var mapped *net.UDPAddr
+	if mapped, err = resp.XORMappedAddress(); err != nil {
+		return
+	}
+
+	timer := time.NewTimer(idle)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		err = ctx.Err()
+		return
+	}
+
+	var req Message
+	if req, err = NewMessage(Binding, Request); err != nil {
+		return
+	}
+	req.SetResponsePort(mapped.Port)
+
+	if _, _, err = d.transact(ctx, y, x, req, server); err == ErrTimeout {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// isLocalAddr returns whether the mapped address is the local address,
+// which can be any of the addresses of the host if it is unspecified
+func isLocalAddr(mapped *net.UDPAddr, local net.Addr) bool {
+	addr, ok := transportAddr(local)
+	if !ok || addr.Port != mapped.Port {
+		return false
+	}
+
+	if !addr.IP.IsUnspecified() {
+		return addr.IP.Equal(mapped.IP)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(mapped.IP) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,278 @@
+package stun
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNAT is a userspace NAT on loopback with the given behaviors. Mappings
+// expire when no packet is sent through them for lifetime, if it is set.
+type testNAT struct {
+	mapping   Behavior
+	filtering Behavior
+	lifetime  time.Duration
+
+	mu    sync.Mutex
+	conns int
+}
+
+// natKey returns the key of addr that selects or permits a mapping for the behavior
+func natKey(b Behavior, addr net.Addr) string {
+	switch b {
+	case AddressDependent:
+		host, _, _ := net.SplitHostPort(addr.String())
+		return host
+	case AddressAndPortDependent:
+		return addr.String()
+	default:
+		return ""
+	}
+}
+
+// natPacket is a packet delivered to an internal socket
+type natPacket struct {
+	data []byte
+	from net.Addr
+}
+
+// natConn is an internal socket behind the NAT
+type natConn struct {
+	nat   *testNAT
+	local *net.UDPAddr
+	in    chan natPacket
+	rd    *deadline
+	done  chan struct{}
+
+	mu       sync.Mutex
+	mappings map[string]*natMapping
+}
+
+type natMapping struct {
+	external  net.PacketConn
+	permitted map[string]bool
+	lastOut   time.Time
+}
+
+func (nat *testNAT) ListenPacket() (net.PacketConn, error) {
+	nat.mu.Lock()
+	nat.conns++
+	port := 10000 + nat.conns
+	nat.mu.Unlock()
+
+	return &natConn{
+		nat:      nat,
+		local:    &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port},
+		in:       make(chan natPacket, packetQueueLen),
+		rd:       newDeadline(),
+		done:     make(chan struct{}),
+		mappings: make(map[string]*natMapping),
+	}, nil
+}
+
+func (c *natConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	key := natKey(c.nat.mapping, addr)
+	m := c.mappings[key]
+	if m != nil && c.nat.lifetime > 0 && time.Since(m.lastOut) > c.nat.lifetime {
+		m.external.Close()
+		m = nil
+	}
+
+	if m == nil {
+		external, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			c.mu.Unlock()
+			return 0, err
+		}
+
+		m = &natMapping{external: external, permitted: make(map[string]bool)}
+		c.mappings[key] = m
+		go c.inbound(m)
+	}
+
+	m.lastOut = time.Now()
+	m.permitted[natKey(c.nat.filtering, addr)] = true
+	c.mu.Unlock()
+
+	return m.external.WriteTo(b, addr)
+}
+
+// inbound delivers the packets received on the mapping that pass the filter
+func (c *natConn) inbound(m *natMapping) {
+	buf := make([]byte, maxpacket)
+	for {
+		n, from, err := m.external.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		expired := c.nat.lifetime > 0 && time.Since(m.lastOut) > c.nat.lifetime
+		permitted := m.permitted[natKey(c.nat.filtering, from)]
+		c.mu.Unlock()
+
+		if expired || !permitted {
+			continue
+		}
+
+		select {
+		case c.in <- natPacket{data: append([]byte(nil), buf[:n]...), from: from}:
+		default:
+		}
+	}
+}
+
+func (c *natConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		expired, changed, stop := c.rd.wait()
+
+		select {
+		case p := <-c.in:
+			stop()
+			return copy(b, p.data), p.from, nil
+		case <-c.done:
+			stop()
+			return 0, nil, net.ErrClosed
+		case <-expired:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			stop()
+		}
+	}
+}
+
+func (c *natConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	close(c.done)
+	for _, m := range c.mappings {
+		m.external.Close()
+	}
+	return nil
+}
+
+func (c *natConn) LocalAddr() net.Addr                { return c.local }
+func (c *natConn) SetDeadline(t time.Time) error      { return c.SetReadDeadline(t) }
+func (c *natConn) SetReadDeadline(t time.Time) error  { c.rd.set(t); return nil }
+func (c *natConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestNATDiscovery(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, tcase := range []struct {
+		nat      *testNAT
+		expected NATBehavior
+	}{
+		{nil, NATBehavior{Mapping: EndpointIndependent, Filtering: EndpointIndependent, Hairpinning: true}},
+		{
+			&testNAT{mapping: EndpointIndependent, filtering: EndpointIndependent},
+			NATBehavior{NAT: true, Mapping: EndpointIndependent, Filtering: EndpointIndependent, Hairpinning: true},
+		},
+		{
+			&testNAT{mapping: AddressDependent, filtering: AddressDependent},
+			NATBehavior{NAT: true, Mapping: AddressDependent, Filtering: AddressDependent, Hairpinning: true},
+		},
+		{
+			&testNAT{mapping: AddressAndPortDependent, filtering: AddressAndPortDependent},
+			NATBehavior{NAT: true, Mapping: AddressAndPortDependent, Filtering: AddressAndPortDependent},
+		},
+		{
+			&testNAT{mapping: EndpointIndependent, filtering: AddressAndPortDependent},
+			NATBehavior{NAT: true, Mapping: EndpointIndependent, Filtering: AddressAndPortDependent},
+		},
+	} {
+		d := &NATDiscovery{
+			Server: pcs[0][0].LocalAddr().String(),
+			RTO:    20 * time.Millisecond,
+			Rc:     2,
+			Rm:     2,
+		}
+		if tcase.nat != nil {
+			d.ListenPacket = tcase.nat.ListenPacket
+		}
+
+		result, err := d.Discover(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.MappedAddress == nil {
+			t.Errorf("expected mapped address")
+		}
+		result.MappedAddress = nil
+		if result != tcase.expected {
+			t.Errorf("expected %+v found %+v", tcase.expected, result)
+		}
+	}
+}
+
+func TestNATDiscoveryLifetime(t *testing.T) {
+	pcs := serveAlternateTestServer(t, &Server{})
+	defer closeAlternates(pcs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	nat := &testNAT{
+		mapping:   EndpointIndependent,
+		filtering: AddressAndPortDependent,
+		lifetime:  330 * time.Millisecond,
+	}
+	d := &NATDiscovery{
+		Server:             pcs[0][0].LocalAddr().String(),
+		ListenPacket:       nat.ListenPacket,
+		RTO:                20 * time.Millisecond,
+		Rc:                 2,
+		Rm:                 2,
+		MaxLifetime:        800 * time.Millisecond,
+		LifetimeResolution: 50 * time.Millisecond,
+	}
+
+	result, err := d.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.BindingLifetime > nat.lifetime || result.BindingLifetime < nat.lifetime-d.LifetimeResolution {
+		t.Errorf("expected binding lifetime within %v of %v found %v", d.LifetimeResolution, nat.lifetime, result.BindingLifetime)
+	}
+
+	if interval := result.KeepAliveInterval(); interval != result.BindingLifetime/2 {
+		t.Errorf("expected keepalive interval %v found %v", result.BindingLifetime/2, interval)
+	}
+}
+
+func TestKeepAliveInterval(t *testing.T) {
+	for _, tcase := range []struct {
+		behavior NATBehavior
+		expected time.Duration
+	}{
+		{NATBehavior{}, 0},
+		{NATBehavior{NAT: true}, DefaultKeepAliveInterval},
+		{NATBehavior{NAT: true, BindingLifetime: time.Minute}, 30 * time.Second},
+	} {
+		if interval := tcase.behavior.KeepAliveInterval(); interval != tcase.expected {
+			t.Errorf("expected %v found %v", tcase.expected, interval)
+		}
+	}
+}
+
+func TestNATDiscoveryUnsupported(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	d := &NATDiscovery{Server: pc.LocalAddr().String(), RTO: 20 * time.Millisecond, Rc: 2, Rm: 2}
+	if _, err := d.Discover(context.Background()); err != ErrNoDiscovery {
+		t.Errorf("expected ErrNoDiscovery but %v found", err)
+	}
+}
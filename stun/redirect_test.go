@@ -0,0 +1,217 @@
+package stun
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRedirect(t *testing.T) {
+	addr, alternate := listenTestServer(t, &Server{})
+	defer alternate.Close()
+
+	conn, pc := serveTestServer(t, &Server{Handler: RedirectHandler(addr)})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// redirections are not followed
+	client := &Client{Conn: conn, MaxRedirects: -1}
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrTryAlternateServer {
+		t.Errorf("expected %v found %v", ErrTryAlternateServer, e)
+	}
+	if found, err := resp.AlternateServer(); err != nil || found.String() != addr.String() {
+		t.Errorf("expected ALTERNATE-SERVER %s found %s: %v", addr, found, err)
+	}
+
+	client.MaxRedirects = 0
+	if resp, err = client.Do(ctx, Message{Class: Request, Method: Binding}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, SuccessResponse)
+	if c := client.conn(); c == conn || c.RemoteAddr().String() != addr.String() {
+		t.Errorf("expected client to be connected to %s", addr)
+	}
+
+	client.Close()
+	if client.conn() != conn {
+		t.Errorf("expected client to be connected to %s after Close", conn.RemoteAddr())
+	}
+}
+
+func TestConnRedirect(t *testing.T) {
+	addr, alternate := listenTestServer(t, &Server{})
+	defer alternate.Close()
+
+	conn, pc := serveTestServer(t, &Server{Handler: RedirectHandler(addr)})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		resp, err := conn.Do(ctx, Message{Class: Request, Method: Binding})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkType(t, &resp, Binding, SuccessResponse)
+	}
+
+	// the connections to the alternate server are closed along with their read loop
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d goroutines but %d found", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	pc2, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc2.Close()
+
+	second := pc2.LocalAddr().(*net.UDPAddr)
+	first, pc1 := listenTestServer(t, &Server{Handler: RedirectHandler(second)})
+	defer pc1.Close()
+	go (&Server{Handler: RedirectHandler(first)}).Serve(pc2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := Dial("udp", first.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewClient(conn)
+	if _, err := client.Do(ctx, Message{Class: Request, Method: Binding}); err != ErrRedirectLoop {
+		t.Errorf("expected ErrRedirectLoop but %v found", err)
+	}
+	client.Close()
+
+	// every server redirects to a new one
+	var chain []*net.UDPAddr
+	for i := 0; i < 3; i++ {
+		next := first
+		if len(chain) > 0 {
+			next = chain[len(chain)-1]
+		}
+		addr, pc := listenTestServer(t, &Server{Handler: RedirectHandler(next)})
+		defer pc.Close()
+		chain = append(chain, addr)
+	}
+
+	conn, err = Dial("udp", chain[len(chain)-1].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client = &Client{Conn: conn, MaxRedirects: 2}
+	if _, err := client.Do(ctx, Message{Class: Request, Method: Binding}); err != ErrTooManyRedirects {
+		t.Errorf("expected ErrTooManyRedirects but %v found", err)
+	}
+	client.Close()
+}
+
+func TestRedirectAuthenticated(t *testing.T) {
+	// the alternate server does not authenticate requests
+	addr, alternate := listenTestServer(t, &Server{})
+	defer alternate.Close()
+
+	conn, pc := serveTestServer(t, &Server{Handler: &LongTermAuth{
+		Realm:       rfc5769LongTermRealm,
+		Credentials: testCredentials,
+		Handler:     RedirectHandler(addr),
+	}})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+	}
+	defer client.Close()
+
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, SuccessResponse)
+	if c := client.conn(); c.RemoteAddr().String() != addr.String() {
+		t.Errorf("expected client to be connected to %s", addr)
+	}
+	if realm, nonce, _ := client.credentials(); realm != nil || nonce != nil {
+		t.Errorf("expected credentials to be discarded but %q and %q found", realm, nonce)
+	}
+}
+
+func TestRedirectForged(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	key := LongTermKey(rfc5769LongTermUsername, rfc5769LongTermRealm, rfc5769LongTermPassword)
+	go func() {
+		buf := make([]byte, maxpacket)
+		n, addr, err := peer.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, _ := Unmarshal(buf[:n])
+
+		// an unprotected redirection is sent before the authentic response
+		forged := req.ErrorResponse(ErrTryAlternateServer)
+		forged.SetAlternateServer(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 3478})
+		data, _ := Marshal(forged)
+		peer.WriteTo(data, addr)
+
+		resp, _ := bindingResponse(&req, conn.LocalAddr().(*net.UDPAddr))
+		data, _ = Marshal(resp)
+		peer.WriteTo(AddIntegrity(data, key), addr)
+	}()
+
+	client := &Client{
+		Conn:     conn,
+		Username: rfc5769LongTermUsername,
+		Password: rfc5769LongTermPassword,
+		realm:    []byte(rfc5769LongTermRealm),
+		nonce:    []byte("nonce"),
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := client.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, SuccessResponse)
+	if client.conn() != conn {
+		t.Errorf("expected forged redirection to be ignored")
+	}
+}
@@ -0,0 +1,385 @@
+package stun
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ErrUnspecifiedAddress is returned by ListenAndServeAlternate when the primary
+// or alternate address has no IP address or an unspecified one, which clients
+// cannot be told to send their requests to
+var ErrUnspecifiedAddress = fmt.Errorf("alternate addresses must have a specific IP address")
+
+// Server dispatches STUN messages received on a net.PacketConn to a Handler
+type Server struct {
+	// Handler to invoke for each received message, DefaultServeMux if nil
+	Handler Handler
+	// KnownAttributes is the set of comprehension-required attributes understood
+	// by the handler. Requests with other comprehension-required attributes
+	// are answered with a 420 error response and indications are discarded,
+	// after LongTermAuth authenticates them if it handles them before any
+	// other handler.
+	// If nil, DefaultKnownAttributes is used, so RFC-3489 requests with a
+	// CHANGE-REQUEST attribute that asks to change the IP address or port are
+	// answered with a 420 error response unless served with ServeAlternate,
+	// which tells clients that the server has no alternate address.
+	KnownAttributes AttrSet
+	// Software, if not empty, is sent in the SOFTWARE attribute of every response
+	Software string
+}
+
+// bindingResponse returns the success response to a Binding request
+// received from addr. RFC-3489 clients get a MAPPED-ADDRESS attribute
+// and RFC-5389 clients an XOR-MAPPED-ADDRESS attribute.
+func bindingResponse(req *Message, addr *net.UDPAddr) (resp Message, err error) {
+	resp = req.Response()
+	if req.IsLegacy() {
+		err = resp.SetMappedAddress(addr)
+	} else {
+		err = resp.SetXORMappedAddress(addr)
+	}
+	return
+}
+
+// badRequest returns a 400 error response to the packet in data if its header
+// can be decoded as a STUN request despite the rest of the message being malformed
+func badRequest(data []byte) (resp Message, ok bool) {
+	if !IsStunCompat(data) {
+		return
+	}
+
+	method, class := decodeType(uint16(data[0])<<8 | uint16(data[1]))
+	if class != Request {
+		return
+	}
+
+	req := Message{Method: method, Class: class, ID: data[4:20]}
+	return req.ErrorResponse(ErrBadRequest), true
+}
+
+// response writes messages to the client that sent a request
+type response struct {
+	srv   *Server
+	write func(data []byte) error
+	in    *Incoming
+}
+
+func (w *response) WriteMessage(msg Message) (err error) {
+	var data []byte
+	if data, err = w.marshal(msg); err != nil {
+		return
+	}
+
+	return w.write(data)
+}
+
+// marshal encodes msg with the SOFTWARE of the server and
+// the integrity of the request, if any
+func (w *response) marshal(msg Message) (data []byte, err error) {
+	if w.srv.Software != "" {
+		msg.Set(Software, []byte(w.srv.Software))
+	}
+
+	if data, err = Marshal(msg); err != nil {
+		return
+	}
+
+	if w.in != nil && w.in.Key != nil {
+		if w.in.IntegritySHA256 {
+			data, _ = AddIntegritySHA256(data, w.in.Key, 0)
+		} else {
+			data = AddIntegrity(data, w.in.Key)
+		}
+	}
+
+	return
+}
+
+// alternates is a group of sockets on a primary and an alternate IP address
+// and port indexed by IP address and port, as used by ServeAlternate
+type alternates [2][2]net.PacketConn
+
+// alternateResponse writes messages from the sockets of a group
+type alternateResponse struct {
+	*response
+	pcs      *alternates
+	ip, port int
+}
+
+func (w *alternateResponse) pc(changeIP, changePort bool) net.PacketConn {
+	ip, port := w.ip, w.port
+	if changeIP {
+		ip ^= 1
+	}
+	if changePort {
+		port ^= 1
+	}
+	return w.pcs[ip][port]
+}
+
+func (w *alternateResponse) AlternateAddr(changeIP, changePort bool) net.Addr {
+	return w.pc(changeIP, changePort).LocalAddr()
+}
+
+func (w *alternateResponse) WriteMessageTo(msg Message, addr net.Addr, changeIP, changePort bool) (err error) {
+	var data []byte
+	if data, err = w.marshal(msg); err != nil {
+		return
+	}
+
+	_, err = w.pc(changeIP, changePort).WriteTo(data, addr)
+	return
+}
+
+func (srv *Server) handler() Handler {
+	if srv.Handler == nil {
+		return DefaultServeMux
+	}
+	return srv.Handler
+}
+
+// serve decodes the message in data received on local from remote and dispatches
+// it to the handler, which responds with write, or from the sockets of the group
+// if pcs is not nil
+func (srv *Server) serve(data []byte, local, remote net.Addr, write func([]byte) error, pcs *alternates, ip, port int) {
+	msg, err := decode(data)
+	w := &response{srv: srv, write: write}
+
+	var rw ResponseWriter = w
+	if pcs != nil {
+		rw = &alternateResponse{response: w, pcs: pcs, ip: ip, port: port}
+	}
+
+	if err != nil {
+		if resp, ok := badRequest(data); ok {
+			w.WriteMessage(resp)
+		}
+		return
+	}
+
+	known := srv.KnownAttributes
+	switch {
+	case known != nil:
+	case pcs != nil:
+		known = alternateKnownAttributes
+	default:
+		known = DefaultKnownAttributes
+	}
+
+	w.in = &Incoming{
+		Message:    msg,
+		Raw:        data,
+		RemoteAddr: remote,
+		LocalAddr:  local,
+		known:      known,
+	}
+
+	h := srv.handler()
+	if !checksUnknown(h) && !checkUnknown(rw, w.in) {
+		return
+	}
+
+	h.ServeSTUN(rw, w.in)
+}
+
+// Serve reads packets from pc and dispatches the STUN messages among them
+// to the server handler. Non-STUN packets are ignored. Messages are handled
+// sequentially so handlers should not block. Serve returns when pc fails to read.
+func (srv *Server) Serve(pc net.PacketConn) error {
+	return srv.servePacket(pc, nil, 0, 0)
+}
+
+func (srv *Server) servePacket(pc net.PacketConn, pcs *alternates, ip, port int) error {
+	buf := make([]byte, maxpacket)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		if !IsStunCompat(buf[:n]) {
+			continue
+		}
+
+		srv.serve(buf[:n], pc.LocalAddr(), addr, func(data []byte) error {
+			_, err := pc.WriteTo(data, addr)
+			return err
+		}, pcs, ip, port)
+	}
+}
+
+// ServeAlternate serves a group of sockets on a primary and an alternate IP address
+// and port, indexed by IP address and port so that pcs[0][0] is the primary address
+// and pcs[1][1] the alternate one, as described in RFC-3489 section-8. Handlers can
+// respond from another socket of the group with AlternateResponseWriter, which is
+// used by ServeBinding to honour CHANGE-REQUEST and RESPONSE-ADDRESS, and the
+// RFC-5780 NAT behavior discovery attributes. As RESPONSE-ADDRESS
+// can be abused to reflect traffic to third parties, it should only be used where
+// RFC-3489 clients must be supported. ServeAlternate returns when any of the sockets
+// fails to read.
+func (srv *Server) ServeAlternate(pcs [2][2]net.PacketConn) error {
+	group := alternates(pcs)
+	errs := make(chan error, 4)
+
+	for ip := range group {
+		for port := range group[ip] {
+			go func(ip, port int) {
+				errs <- srv.servePacket(group[ip][port], &group, ip, port)
+			}(ip, port)
+		}
+	}
+
+	return <-errs
+}
+
+// ListenAndServeAlternate listens on the primary and alternate addresses of the given
+// packet-oriented network and on the primary IP address with the alternate port and
+// vice versa, and then calls ServeAlternate. Zero ports are chosen by the system.
+// Both addresses must have a specific IP address as they are sent to the clients
+// in OTHER-ADDRESS and CHANGED-ADDRESS, otherwise ErrUnspecifiedAddress is returned.
+func (srv *Server) ListenAndServeAlternate(network, primary, alternate string) error {
+	pcs, err := listenAlternate(network, primary, alternate)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		for ip := range pcs {
+			for port := range pcs[ip] {
+				pcs[ip][port].Close()
+			}
+		}
+	}()
+
+	return srv.ServeAlternate(pcs)
+}
+
+// listenAlternate listens on the four combinations of the IP addresses and ports
+// of the primary and alternate addresses
+func listenAlternate(network, primary, alternate string) (pcs [2][2]net.PacketConn, err error) {
+	var hosts, ports [2]string
+	if hosts[0], ports[0], err = net.SplitHostPort(primary); err != nil {
+		return
+	}
+	if hosts[1], ports[1], err = net.SplitHostPort(alternate); err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			err = ErrUnspecifiedAddress
+			return
+		}
+	}
+
+listen:
+	for port := range ports {
+		for ip := range hosts {
+			if pcs[ip][port], err = net.ListenPacket(network, net.JoinHostPort(hosts[ip], ports[port])); err != nil {
+				break listen
+			}
+
+			// the port chosen by the system is used for both IP addresses
+			_, ports[port], _ = net.SplitHostPort(pcs[ip][port].LocalAddr().String())
+		}
+	}
+
+	if err != nil {
+		for ip := range pcs {
+			for port := range pcs[ip] {
+				if pcs[ip][port] != nil {
+					pcs[ip][port].Close()
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// ServeListener accepts connections on the stream-oriented listener l and
+// dispatches the STUN messages framed in them to the server handler.
+// Connections carrying non-STUN data are closed. ServeListener returns
+// when l fails to accept.
+func (srv *Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go srv.serveStream(conn)
+	}
+}
+
+// serveStream handles the STUN messages framed in the stream until it fails
+func (srv *Server) serveStream(conn net.Conn) {
+	defer conn.Close()
+
+	var mu sync.Mutex
+	write := func(data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := conn.Write(data)
+		return err
+	}
+
+	dec := NewDecoder(conn)
+	for {
+		data, err := dec.frame()
+		if err != nil {
+			return
+		}
+
+		srv.serve(data, conn.LocalAddr(), conn.RemoteAddr(), write, nil, 0, 0)
+	}
+}
+
+// ListenAndServe listens on the given network address and then calls
+// ServeListener for stream-oriented networks or Serve otherwise
+func (srv *Server) ListenAndServe(network, address string) error {
+	if isStream(network) {
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+
+		return srv.ServeListener(l)
+	}
+
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	return srv.Serve(pc)
+}
+
+// ListenAndServeTLS listens on the given TCP network address and then calls
+// ServeListener with TLS connections using the given certificate and key files
+func (srv *Server) ListenAndServeTLS(network, address, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	l, err := tls.Listen(network, address, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return srv.ServeListener(l)
+}
+
+// ListenAndServe listens on the given network address and dispatches
+// the received STUN messages to handler, which is usually nil
+// meaning DefaultServeMux is used
+func ListenAndServe(network, address string, handler Handler) error {
+	return (&Server{Handler: handler}).ListenAndServe(network, address)
+}
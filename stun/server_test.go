@@ -0,0 +1,136 @@
+package stun
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenTestServer starts srv on loopback and returns its address
+func listenTestServer(t *testing.T, srv *Server) (*net.UDPAddr, net.PacketConn) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(pc)
+
+	return pc.LocalAddr().(*net.UDPAddr), pc
+}
+
+// serveTestServer starts srv on loopback and returns a Conn connected to it
+func serveTestServer(t *testing.T, srv *Server) (*Conn, net.PacketConn) {
+	addr, pc := listenTestServer(t, srv)
+
+	conn, err := Dial("udp", addr.String())
+	if err != nil {
+		pc.Close()
+		t.Fatal(err)
+	}
+
+	return conn, pc
+}
+
+func TestServerBinding(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{Software: "test server"})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := conn.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	addr, err := resp.XORMappedAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != conn.LocalAddr().String() {
+		t.Errorf("expected mapped address %s found %s", conn.LocalAddr(), addr)
+	}
+
+	if software, _ := resp.Get(Software); string(software) != "test server" {
+		t.Errorf("expected SOFTWARE to be %q but %q found", "test server", software)
+	}
+}
+
+// exchange sends data to the server and returns the decoded response
+func exchange(t *testing.T, pc net.PacketConn, data []byte) (Message, net.Addr) {
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.WriteTo(data, pc.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxpacket)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := UnmarshalCompat(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg, client.LocalAddr()
+}
+
+func TestServerLegacyBinding(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	data, err := Marshal(Message{Class: Request, Method: Binding, ID: rfc3489SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, local := exchange(t, pc, data)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	if !resp.IsLegacy() {
+		t.Errorf("expected response to be legacy")
+	}
+
+	addr, err := resp.MappedAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != local.String() {
+		t.Errorf("expected mapped address %s found %s", local, addr)
+	}
+}
+
+func TestServerBadRequest(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	// declared length is bigger than the packet
+	malformed := append([]byte(nil), rfc5769SampleRequestLongTermAuthBytes[:40]...)
+
+	unknownMethod, err := Marshal(Message{Class: Request, Method: Method(0x002), ID: rfc5769SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{malformed, unknownMethod} {
+		resp, _ := exchange(t, pc, data)
+		checkType(t, &resp, Method(uint16(data[0])<<8|uint16(data[1])), ErrorResponse)
+
+		if e, _ := resp.ErrorCode(); e != ErrBadRequest {
+			t.Errorf("expected %v found %v", ErrBadRequest, e)
+		}
+	}
+}
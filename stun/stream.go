@@ -0,0 +1,19 @@
+package stun
+
+import (
+	"time"
+)
+
+// DefaultReliableTimeout is the transaction timeout Ti over reliable
+// transports as described in RFC-5389 section-7.2.2
+const DefaultReliableTimeout = 39500 * time.Millisecond
+
+// isStream returns whether the network is a stream-oriented transport
+func isStream(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	default:
+		return false
+	}
+}
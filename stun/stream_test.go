@@ -0,0 +1,148 @@
+package stun
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gortc test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func checkStreamBinding(t *testing.T, conn *Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := conn.Do(ctx, Message{Class: Request, Method: Binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	addr, err := resp.XORMappedAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != conn.LocalAddr().String() {
+		t.Errorf("expected mapped address %s found %s", conn.LocalAddr(), addr)
+	}
+}
+
+func TestServerTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&Server{}).ServeListener(l)
+
+	conn, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	checkStreamBinding(t, conn)
+}
+
+func TestServerTLS(t *testing.T) {
+	cert := testCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&Server{}).ServeListener(l)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	conn, err := DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	checkStreamBinding(t, conn)
+}
+
+func TestClientReliableTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	requests := make(chan int)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		n := 0
+		dec := NewDecoder(conn)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, err := dec.frame(); err != nil {
+				requests <- n
+				return
+			}
+			n++
+		}
+	}()
+
+	conn, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := &Client{Conn: conn, RTO: time.Millisecond, ReliableTimeout: 20 * time.Millisecond}
+	start := time.Now()
+	if _, err := client.Do(context.Background(), Message{Class: Request, Method: Binding}); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout but %v found", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected transaction to last at least 20ms but %v found", elapsed)
+	}
+	if n := <-requests; n != 1 {
+		t.Errorf("expected requests not to be retransmitted but %d found", n)
+	}
+}
@@ -1,51 +1,417 @@
 package stun
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Conn represents a connection with RFC-5389 STUN capabilities
-type Conn struct{}
+const (
+	maxipdatalen = 65535
+	ipheaderlen  = 20
+	maxpacket    = maxipdatalen - ipheaderlen
+)
+
+// number of application packets buffered by Conn before they are dropped
+const packetQueueLen = 64
+
+// packet is an application payload or a read error
+type packet struct {
+	data []byte
+	err  error
+}
+
+// received is a STUN response routed to a pending transaction
+// along with its encoding so its integrity can be checked
+type received struct {
+	msg Message
+	raw []byte
+}
+
+// deadline can be waited on and wakes up waiters when it is changed
+type deadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{changed: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	d.t = t
+	close(d.changed)
+	d.changed = make(chan struct{})
+	d.mu.Unlock()
+}
+
+// wait returns a channel that fires when the deadline expires, which is nil
+// if there is no deadline, and a channel that is closed when it changes
+func (d *deadline) wait() (expired <-chan time.Time, changed <-chan struct{}, stop func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stop = func() {}
+	if !d.t.IsZero() {
+		timer := time.NewTimer(time.Until(d.t))
+		expired = timer.C
+		stop = func() { timer.Stop() }
+	}
+
+	return expired, d.changed, stop
+}
+
+// Conn represents a connection with RFC-5389 STUN capabilities.
+// STUN messages received on the connection are handled internally:
+// Binding requests are answered and responses are routed to
+// the pending transactions started with Do. Read returns only
+// the non-STUN payloads so media and STUN can share a single socket.
+//
+// Over stream-oriented transports such as TCP and TLS, messages are framed
+// using the length field of their header and the connection can only
+// carry STUN messages.
+type Conn struct {
+	conn    net.Conn
+	stream  bool
+	packets chan packet
+	done    chan struct{}
+	once    sync.Once
+	rd      *deadline
+	// dial connects to another server over the same transport
+	dial func(address string) (*Conn, error)
+	// unix nanoseconds of the last write
+	lastWrite atomic.Int64
+
+	kmu       sync.Mutex
+	keepalive chan struct{}
+
+	mu           sync.Mutex
+	transactions map[string]chan received
+}
+
+// NewConn returns a Conn that demultiplexes STUN messages from application data
+// received on the given connection
+func NewConn(conn net.Conn) *Conn {
+	_, isPacket := conn.(net.PacketConn)
+
+	c := &Conn{
+		conn:         conn,
+		stream:       !isPacket,
+		packets:      make(chan packet, packetQueueLen),
+		done:         make(chan struct{}),
+		rd:           newDeadline(),
+		transactions: make(map[string]chan received),
+	}
+
+	c.dial = func(address string) (*Conn, error) {
+		return Dial(conn.RemoteAddr().Network(), address)
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		config := &tls.Config{ServerName: tlsConn.ConnectionState().ServerName}
+		c.dial = func(address string) (*Conn, error) {
+			return DialTLS(conn.RemoteAddr().Network(), address, config)
+		}
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+func (conn *Conn) readLoop() {
+	if conn.stream {
+		conn.readStream()
+		return
+	}
+
+	buf := make([]byte, maxpacket)
+
+	for {
+		n, err := conn.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			conn.queue(packet{err: err})
+			continue
+		}
 
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		if IsStun(data) {
+			conn.handle(data)
+			continue
+		}
+
+		conn.queue(packet{data: data})
+	}
+}
+
+// readStream handles the STUN messages framed in the stream until it fails
+func (conn *Conn) readStream() {
+	dec := NewDecoder(conn.conn)
+
+	for {
+		data, err := dec.frame()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				conn.queue(packet{err: err})
+			}
+			return
+		}
+
+		conn.handle(append([]byte(nil), data...))
+	}
+}
+
+// queue delivers p to Read or drops it if the queue is full
+func (conn *Conn) queue(p packet) {
+	select {
+	case conn.packets <- p:
+	default:
+	}
+}
+
+func (conn *Conn) handle(data []byte) {
+	msg, err := Unmarshal(data)
+	if err != nil {
+		return
+	}
+
+	switch msg.Class {
+	case Request:
+		if resp, ok := unknownResponse(&msg, DefaultKnownAttributes); ok {
+			conn.WriteMessage(resp)
+			return
+		}
+
+		resp := msg.ErrorResponse(ErrBadRequest)
+		if addr, ok := transportAddr(conn.conn.RemoteAddr()); ok && msg.Method == Binding {
+			if resp, err = bindingResponse(&msg, addr); err != nil {
+				resp = msg.ErrorResponse(ErrServerError)
+			}
+		}
+		conn.WriteMessage(resp)
+	case SuccessResponse, ErrorResponse:
+		conn.mu.Lock()
+		ch := conn.transactions[string(msg.ID)]
+		conn.mu.Unlock()
+
+		if ch != nil {
+			select {
+			case ch <- received{msg, data}:
+			default:
+			}
+		}
+	default:
+		// indications are ignored
+	}
+}
+
+// register starts waiting for responses with the given transaction ID
+func (conn *Conn) register(id []byte) <-chan received {
+	ch := make(chan received, 1)
+
+	conn.mu.Lock()
+	conn.transactions[string(id)] = ch
+	conn.mu.Unlock()
+
+	return ch
+}
+
+func (conn *Conn) unregister(id []byte) {
+	conn.mu.Lock()
+	delete(conn.transactions, string(id))
+	conn.mu.Unlock()
+}
+
+// WriteMessage marshals and sends msg to the remote peer
+func (conn *Conn) WriteMessage(msg Message) (err error) {
+	var data []byte
+	if data, err = Marshal(msg); err != nil {
+		return
+	}
+
+	_, err = conn.Write(data)
+	return
+}
+
+// Do performs a transaction with the default retransmission parameters.
+// See Client.Do for details. The connection to the alternate server of
+// a redirected transaction is closed once the transaction completes.
+func (conn *Conn) Do(ctx context.Context, req Message) (resp Message, err error) {
+	c := NewClient(conn)
+	defer c.Close()
+	return c.Do(ctx, req)
+}
+
+// Read reads the next non-STUN packet received on the connection
 func (conn *Conn) Read(b []byte) (n int, err error) {
-	panic("todo")
+	for {
+		expired, changed, stop := conn.rd.wait()
+
+		select {
+		case p := <-conn.packets:
+			stop()
+			if p.err != nil {
+				return 0, p.err
+			}
+			return copy(b, p.data), nil
+		case <-conn.done:
+			stop()
+			return 0, net.ErrClosed
+		case <-expired:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			stop()
+		}
+	}
 }
 
 func (conn *Conn) Write(b []byte) (n int, err error) {
-	panic("todo")
+	conn.lastWrite.Store(time.Now().UnixNano())
+	return conn.conn.Write(b)
 }
 
-func (conn *Conn) Close() error {
-	panic("todo")
+// SetKeepAlive sends a Binding indication whenever nothing has been written
+// to the connection for the given interval, so NAT bindings are kept alive as
+// described in RFC-5389 section-2. The interval is usually the one recommended
+// by NATBehavior.KeepAliveInterval. Zero or a negative interval disables it.
+func (conn *Conn) SetKeepAlive(interval time.Duration) {
+	conn.kmu.Lock()
+	defer conn.kmu.Unlock()
+
+	if conn.keepalive != nil {
+		close(conn.keepalive)
+		conn.keepalive = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	conn.keepalive = make(chan struct{})
+	go conn.keepAlive(interval, conn.keepalive)
+}
+
+func (conn *Conn) keepAlive(interval time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-stop:
+			return
+		case <-conn.done:
+			return
+		}
+
+		idle := time.Since(time.Unix(0, conn.lastWrite.Load()))
+		if idle >= interval {
+			if id, err := NewTransactionID(); err == nil {
+				conn.WriteMessage(Message{Class: Indication, Method: Binding, ID: id})
+			}
+			idle = 0
+		}
+
+		timer.Reset(interval - idle)
+	}
+}
+
+// Close closes the connection and stops handling STUN messages
+func (conn *Conn) Close() (err error) {
+	err = net.ErrClosed
+	conn.once.Do(func() {
+		close(conn.done)
+		err = conn.conn.Close()
+	})
+
+	return
 }
 
 func (conn *Conn) LocalAddr() net.Addr {
-	panic("todo")
+	return conn.conn.LocalAddr()
 }
 
 func (conn *Conn) RemoteAddr() net.Addr {
-	panic("todo")
+	return conn.conn.RemoteAddr()
 }
 
 func (conn *Conn) SetDeadline(t time.Time) error {
-	panic("todo")
+	conn.rd.set(t)
+	return conn.conn.SetWriteDeadline(t)
 }
 
 func (conn *Conn) SetReadDeadline(t time.Time) error {
-	panic("todo")
+	conn.rd.set(t)
+	return nil
 }
 
 func (conn *Conn) SetWriteDeadline(t time.Time) error {
-	panic("todo")
+	return conn.conn.SetWriteDeadline(t)
+}
+
+// Dial connects to the address on the named network and returns a Conn
+// that handles STUN messages. Known networks are those of net.Dial and
+// "tls", which connects over TCP using TLS with the default configuration.
+func Dial(network, address string) (*Conn, error) {
+	return DialTimeout(network, address, 0)
 }
 
-func Dial(network, address string) (Conn, error) {
-	panic("todo")
+// DialTimeout acts like Dial but takes a timeout
+func DialTimeout(network, address string, timeout time.Duration) (*Conn, error) {
+	if network == "tls" {
+		return dialTLS("tcp", address, timeout, nil)
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConn(conn)
+	c.dial = func(address string) (*Conn, error) {
+		return DialTimeout(network, address, timeout)
+	}
 
+	return c, nil
 }
 
-func DialTimeout(network, address string, timeout time.Duration) (Conn, error) {
-	panic("todo")
+// DialTLS connects to the address on the named stream-oriented network
+// using TLS with the given configuration, which can be nil for the default one
+func DialTLS(network, address string, config *tls.Config) (*Conn, error) {
+	return dialTLS(network, address, 0, config)
+}
+
+func dialTLS(network, address string, timeout time.Duration, config *tls.Config) (*Conn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the alternate servers of a redirection are authenticated with the
+	// same server name as described in RFC-8489 section-10
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = conn.ConnectionState().ServerName
+	}
+
+	c := NewConn(conn)
+	c.dial = func(address string) (*Conn, error) {
+		return dialTLS(network, address, timeout, config)
+	}
 
+	return c, nil
 }
@@ -0,0 +1,182 @@
+package stun
+
+import (
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// dialTestPeer returns a Conn connected to a plain UDP socket on loopback
+func dialTestPeer(t *testing.T) (*Conn, net.PacketConn) {
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := Dial("udp", peer.LocalAddr().String())
+	if err != nil {
+		peer.Close()
+		t.Fatal(err)
+	}
+
+	return conn, peer
+}
+
+func readMessage(t *testing.T, pc net.PacketConn) (Message, net.Addr) {
+	buf := make([]byte, maxpacket)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC-3489 messages are decoded too
+	var msg Message
+	if err := msg.Decode(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+
+	return msg, addr
+}
+
+func writeMessage(t *testing.T, pc net.PacketConn, msg Message, addr net.Addr) {
+	data, err := Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pc.WriteTo(data, addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnDemultiplex(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	req := Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID}
+	writeMessage(t, peer, req, conn.LocalAddr())
+
+	resp, _ := readMessage(t, peer)
+	checkType(t, &resp, Binding, SuccessResponse)
+
+	addr, err := resp.XORMappedAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != peer.LocalAddr().String() {
+		t.Errorf("expected mapped address %s found %s", peer.LocalAddr(), addr)
+	}
+
+	if _, err := peer.WriteTo(rtcpPacket, conn.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxpacket)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rtcpPacket, buf[:n]) {
+		t.Errorf("expected %#v found %#v", rtcpPacket, buf[:n])
+	}
+}
+
+func TestConnDo(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	go func() {
+		buf := make([]byte, maxpacket)
+		n, addr, err := peer.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, _ := Unmarshal(buf[:n])
+
+		// unrelated transaction is ignored
+		data, _ := Marshal(Message{Class: SuccessResponse, Method: Binding, ID: rfc3489SampleRequest.ID})
+		peer.WriteTo(data, addr)
+		data, _ = Marshal(req.ErrorResponse(ErrUnauthorized))
+		peer.WriteTo(data, addr)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := conn.Do(ctx, Message{Class: Request, Method: Binding, ID: rfc5769SampleRequest.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrUnauthorized {
+		t.Errorf("expected %v found %v", ErrUnauthorized, e)
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != os.ErrDeadlineExceeded {
+		t.Errorf("expected os.ErrDeadlineExceeded but %v found", err)
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	done := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	conn.Close()
+	if err := <-done; err != net.ErrClosed {
+		t.Errorf("expected net.ErrClosed but %v found", err)
+	}
+}
+
+func TestConnKeepAlive(t *testing.T) {
+	conn, peer := dialTestPeer(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	conn.SetKeepAlive(20 * time.Millisecond)
+
+	msg, _ := readMessage(t, peer)
+	checkType(t, &msg, Binding, Indication)
+
+	// keepalives are not sent while the connection is in use
+	conn.SetKeepAlive(50 * time.Millisecond)
+	buf := make([]byte, maxpacket)
+	for i := 0; i < 10; i++ {
+		if _, err := conn.Write(rtcpPacket); err != nil {
+			t.Fatal(err)
+		}
+
+		peer.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := peer.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsStun(buf[:n]) {
+			t.Fatalf("unexpected keepalive while writing")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn.SetKeepAlive(0)
+	peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := peer.ReadFrom(buf); !os.IsTimeout(err) {
+		t.Errorf("expected no keepalive once disabled but %v found", err)
+	}
+}
@@ -0,0 +1,144 @@
+package stun
+
+import (
+	"fmt"
+)
+
+// ErrBadUnknownAttributes is returned when an UNKNOWN-ATTRIBUTES
+// attribute has an invalid length
+var ErrBadUnknownAttributes = fmt.Errorf("bad unknown attributes attribute")
+
+// Required returns whether the attribute type is in the comprehension-required
+// range 0x0000-0x7FFF as described in RFC-5389 section-15
+func (t AttrType) Required() bool {
+	return t < 0x8000
+}
+
+// AttrSet is a set of attribute types
+type AttrSet map[AttrType]bool
+
+// DefaultKnownAttributes is the set of comprehension-required attributes
+// understood by this package. It does not include CHANGE-REQUEST, which is
+// only understood by servers with alternate addresses, but RFC-3489 requests
+// with a CHANGE-REQUEST that does not change the IP address or port are
+// answered by any server.
+var DefaultKnownAttributes = AttrSet{
+	MappedAddress:     true,
+	Username:          true,
+	MessageIntegrity:  true,
+	ErrorCode:         true,
+	UnknownAttributes: true,
+	Realm:             true,
+	Nonce:             true,
+	XORMappedAddress:  true,
+
+	MessageIntegritySHA256: true,
+	PasswordAlgorithm:      true,
+	UserHash:               true,
+}
+
+// Unknown returns the comprehension-required attribute types
+// of the message that are not in the known set
+func (msg *Message) Unknown(known AttrSet) (types []AttrType) {
+	for _, a := range msg.Attr {
+		if a.Type.Required() && !known[a.Type] {
+			types = append(types, a.Type)
+		}
+	}
+
+	return
+}
+
+// UnknownAttributes decodes the UNKNOWN-ATTRIBUTES attribute of the message
+// as described in RFC-5389 section-15.9
+func (msg *Message) UnknownAttributes() (types []AttrType, err error) {
+	var value []byte
+	if value, err = msg.Get(UnknownAttributes); err != nil {
+		return
+	}
+
+	if len(value)%2 != 0 {
+		err = ErrBadUnknownAttributes
+		return
+	}
+
+	types = make([]AttrType, len(value)/2)
+	for i := range types {
+		types[i] = AttrType(uint16(value[2*i])<<8 | uint16(value[2*i+1]))
+	}
+
+	return
+}
+
+// SetUnknownAttributes encodes types into the UNKNOWN-ATTRIBUTES attribute of the message
+func (msg *Message) SetUnknownAttributes(types []AttrType) {
+	value := make([]byte, 2*len(types))
+	for i, t := range types {
+		value[2*i] = byte(t >> 8)
+		value[2*i+1] = byte(t)
+	}
+
+	msg.Set(UnknownAttributes, value)
+}
+
+// unknownResponse returns a 420 error response listing the comprehension-required
+// attributes of the request that are not in the known set as described in
+// RFC-5389 section-7.3.1, or false if there are none
+func unknownResponse(req *Message, known AttrSet) (resp Message, ok bool) {
+	var unknown []AttrType
+	for _, t := range req.Unknown(known) {
+		if t != ChangeAddress || !emptyChangeRequest(req) {
+			unknown = append(unknown, t)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return
+	}
+
+	resp = req.ErrorResponse(ErrUnknownAttribute)
+	resp.SetUnknownAttributes(unknown)
+
+	return resp, true
+}
+
+// checkUnknown answers a request with unknown comprehension-required attributes
+// with a 420 error response and discards such an indication as described in
+// RFC-5389 section-7.3, and returns whether the message can be handled. The
+// attributes of a message are only checked once along the handler chain.
+func checkUnknown(w ResponseWriter, in *Incoming) bool {
+	if in.checked {
+		return true
+	}
+	in.checked = true
+
+	known := in.known
+	if known == nil {
+		known = DefaultKnownAttributes
+	}
+
+	switch in.Class {
+	case Request:
+		if resp, ok := unknownResponse(&in.Message, known); ok {
+			w.WriteMessage(resp)
+			return false
+		}
+	case Indication:
+		if len(in.Unknown(known)) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checksUnknown returns whether the handler checks the unknown attributes of the
+// messages itself: LongTermAuth does it once a message is authenticated so that
+// 420 responses are protected, and ServeMux before dispatching it
+func checksUnknown(h Handler) bool {
+	switch h.(type) {
+	case *LongTermAuth, *ServeMux:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package stun
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRequired(t *testing.T) {
+	for _, tcase := range []struct {
+		t        AttrType
+		required bool
+	}{
+		{MappedAddress, true},
+		{XORMappedAddress, true},
+		{AttrType(0x7fff), true},
+		{AttrType(0x8000), false},
+		{Software, false},
+		{FingerPrint, false},
+	} {
+		if tcase.t.Required() != tcase.required {
+			t.Errorf("expected %#04x required to be %v", tcase.t, tcase.required)
+		}
+	}
+}
+
+func TestUnknownAttributes(t *testing.T) {
+	// PRIORITY is comprehension-required and ICE-CONTROLLED is optional
+	if unknown := rfc5769SampleRequest.Unknown(DefaultKnownAttributes); !reflect.DeepEqual(unknown, []AttrType{0x24}) {
+		t.Errorf("expected unknown attributes to be [0x24] but %#v found", unknown)
+	}
+
+	known := AttrSet{Username: true, MessageIntegrity: true, 0x24: true}
+	if unknown := rfc5769SampleRequest.Unknown(known); len(unknown) != 0 {
+		t.Errorf("expected no unknown attributes but %#v found", unknown)
+	}
+
+	var msg Message
+	for _, types := range [][]AttrType{{0x24}, {0x24, 0x25}, {0x24, 0x25, 0x7fff}} {
+		msg.SetUnknownAttributes(types)
+
+		data, err := Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data)%4 != 0 {
+			t.Errorf("expected UNKNOWN-ATTRIBUTES to be padded")
+		}
+
+		found, err := msg.UnknownAttributes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(types, found) {
+			t.Errorf("expected %#v found %#v", types, found)
+		}
+	}
+}
+
+func TestServerUnknownAttributes(t *testing.T) {
+	conn, pc := serveTestServer(t, &Server{})
+	defer pc.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	req := Message{Class: Request, Method: Binding, Attr: rfc5769SampleRequest.Attr[:3]}
+	resp, err := conn.Do(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkType(t, &resp, Binding, ErrorResponse)
+	if e, _ := resp.ErrorCode(); e != ErrUnknownAttribute {
+		t.Errorf("expected %v found %v", ErrUnknownAttribute, e)
+	}
+	if unknown, _ := resp.UnknownAttributes(); !reflect.DeepEqual(unknown, []AttrType{0x24}) {
+		t.Errorf("expected unknown attributes to be [0x24] but %#v found", unknown)
+	}
+
+	pc.Close()
+	conn, pc = serveTestServer(t, &Server{KnownAttributes: AttrSet{0x24: true}})
+	defer pc.Close()
+	defer conn.Close()
+
+	if resp, err = conn.Do(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	checkType(t, &resp, Binding, SuccessResponse)
+}